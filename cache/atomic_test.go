@@ -0,0 +1,282 @@
+package cache
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// atomicWorkers and atomicRounds size the concurrency tests
+const (
+	atomicWorkers = 16
+	atomicRounds  = 50
+)
+
+// atomicBackends returns a fresh cache of each backend with native atomic
+// operations, including a real Redis server if REDIS_ADDR is set
+func atomicBackends(t *testing.T) map[string]Cache {
+	memory, err := New(Config{Type: "memory"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { memory.Close() })
+
+	backends := map[string]Cache{
+		"memory": memory,
+		"disk":   newTestDiskCache(t, filepath.Join(t.TempDir(), "cache.log")),
+		"redis":  newTestRedisCache(t),
+	}
+	if server := newRealRedisCache(t); server != nil {
+		backends["redis-server"] = server
+	}
+	return backends
+}
+
+func TestIncrConcurrent(t *testing.T) {
+	for name, c := range atomicBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			results := make(chan int64, atomicWorkers*atomicRounds)
+
+			var wg sync.WaitGroup
+			for i := 0; i < atomicWorkers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < atomicRounds; j++ {
+						value, err := c.Incr(ctx, "counter", 1, time.Minute)
+						if err != nil {
+							t.Errorf("Incr: %v", err)
+							return
+						}
+						results <- value
+					}
+				}()
+			}
+			wg.Wait()
+			close(results)
+
+			// Every increment must observe a distinct value
+			seen := make(map[int64]bool)
+			for value := range results {
+				if seen[value] {
+					t.Fatalf("Incr returned %d twice", value)
+				}
+				seen[value] = true
+			}
+
+			final, err := c.Incr(ctx, "counter", 0, 0)
+			if err != nil {
+				t.Fatalf("Incr: %v", err)
+			}
+			if want := int64(atomicWorkers * atomicRounds); final != want {
+				t.Fatalf("counter = %d, want %d", final, want)
+			}
+		})
+	}
+}
+
+func TestSetNXConcurrent(t *testing.T) {
+	for name, c := range atomicBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			for round := 0; round < atomicRounds; round++ {
+				var mutex sync.Mutex
+				var winners []int
+
+				var wg sync.WaitGroup
+				for i := 0; i < atomicWorkers; i++ {
+					wg.Add(1)
+					go func(worker int) {
+						defer wg.Done()
+						stored, err := c.SetNX(ctx, "leader", worker, time.Minute)
+						if err != nil {
+							t.Errorf("SetNX: %v", err)
+							return
+						}
+						if stored {
+							mutex.Lock()
+							winners = append(winners, worker)
+							mutex.Unlock()
+						}
+					}(i)
+				}
+				wg.Wait()
+
+				if len(winners) != 1 {
+					t.Fatalf("round %d: %d SetNX calls succeeded, want 1", round, len(winners))
+				}
+				value, err := c.GetCtx(ctx, "leader")
+				if err != nil {
+					t.Fatalf("Get: %v", err)
+				}
+				if cachedInt(value) != int64(winners[0]) {
+					t.Fatalf("round %d: stored %v, want winner %d", round, value, winners[0])
+				}
+				if err := c.DeleteCtx(ctx, "leader"); err != nil {
+					t.Fatalf("Delete: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestCompareAndSwapConcurrent(t *testing.T) {
+	for name, c := range atomicBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if err := c.SetCtx(ctx, "balance", 0, time.Minute); err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+
+			// Each worker increments through a read-modify-CAS loop; lost
+			// updates would leave the total short
+			var wg sync.WaitGroup
+			for i := 0; i < atomicWorkers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < atomicRounds; j++ {
+						for {
+							value, err := c.GetCtx(ctx, "balance")
+							if err != nil {
+								t.Errorf("Get: %v", err)
+								return
+							}
+							current := cachedInt(value)
+							swapped, err := c.CompareAndSwap(ctx, "balance", current, current+1, time.Minute)
+							if err != nil {
+								t.Errorf("CompareAndSwap: %v", err)
+								return
+							}
+							if swapped {
+								break
+							}
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			value, err := c.GetCtx(ctx, "balance")
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if got, want := cachedInt(value), int64(atomicWorkers*atomicRounds); got != want {
+				t.Fatalf("balance = %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestCompareAndSwapMismatch(t *testing.T) {
+	for name, c := range atomicBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			swapped, err := c.CompareAndSwap(ctx, "missing", 1, 2, 0)
+			if err != nil || swapped {
+				t.Fatalf("CompareAndSwap on missing key = %v, %v; want false, nil", swapped, err)
+			}
+
+			c.SetCtx(ctx, "key", "a", 0)
+			swapped, err = c.CompareAndSwap(ctx, "key", "b", "c", 0)
+			if err != nil || swapped {
+				t.Fatalf("CompareAndSwap with stale old = %v, %v; want false, nil", swapped, err)
+			}
+			if value, _ := c.GetCtx(ctx, "key"); value != "a" {
+				t.Fatalf("value = %v, want a", value)
+			}
+		})
+	}
+}
+
+// account is a struct whose fields do not encode in sorted order
+type account struct {
+	Owner   string `json:"owner"`
+	Balance int    `json:"balance"`
+}
+
+func TestCompareAndSwapReadValue(t *testing.T) {
+	for name, c := range atomicBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if err := c.SetCtx(ctx, "account", account{Owner: "alice", Balance: 10}, 0); err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+
+			// JSON backends return a map, which encodes with sorted keys
+			got, err := c.GetCtx(ctx, "account")
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			swapped, err := c.CompareAndSwap(ctx, "account", got, account{Owner: "alice", Balance: 20}, 0)
+			if err != nil || !swapped {
+				t.Fatalf("CompareAndSwap with the value just read = %v, %v; want true, nil", swapped, err)
+			}
+
+			swapped, err = c.CompareAndSwap(ctx, "account", got, account{Owner: "alice", Balance: 30}, 0)
+			if err != nil || swapped {
+				t.Fatalf("CompareAndSwap with a replaced value = %v, %v; want false, nil", swapped, err)
+			}
+		})
+	}
+}
+
+func TestCompareAndSwapKeepsTags(t *testing.T) {
+	memory, err := New(Config{Type: "memory"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { memory.Close() })
+
+	backends := map[string]Cache{
+		"memory": memory,
+		"disk":   newTestDiskCache(t, filepath.Join(t.TempDir(), "cache.log")),
+	}
+	if server := newRealRedisCache(t); server != nil {
+		backends["redis-server"] = server
+	}
+	for name, c := range backends {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if err := c.SetWithTags(ctx, "user:1", "alice", 0, []string{"users"}); err != nil {
+				t.Fatalf("SetWithTags: %v", err)
+			}
+			if swapped, err := c.CompareAndSwap(ctx, "user:1", "alice", "alicia", 0); err != nil || !swapped {
+				t.Fatalf("CompareAndSwap = %v, %v; want true, nil", swapped, err)
+			}
+
+			if err := c.InvalidateTag(ctx, "users"); err != nil {
+				t.Fatalf("InvalidateTag: %v", err)
+			}
+			if c.ExistsCtx(ctx, "user:1") {
+				t.Fatal("key survived InvalidateTag after CompareAndSwap")
+			}
+		})
+	}
+}
+
+func TestIncrNotInteger(t *testing.T) {
+	for name, c := range atomicBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			c.SetCtx(ctx, "name", "alice", 0)
+			if _, err := c.Incr(ctx, "name", 1, 0); err != ErrNotInteger {
+				t.Fatalf("Incr on a string = %v, want ErrNotInteger", err)
+			}
+		})
+	}
+}
+
+// cachedInt converts a cached number, which JSON backends decode as float64
+func cachedInt(value interface{}) int64 {
+	if f, ok := value.(float64); ok {
+		return int64(f)
+	}
+	n, _ := toInt64(value)
+	return n
+}
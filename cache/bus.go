@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// InvalidationBus broadcasts invalidated keys to every subscribed cache instance
+type InvalidationBus interface {
+	Publish(ctx context.Context, key string) error
+	Subscribe(handler func(key string)) error
+	Close() error
+}
+
+// MemoryBus is an in-process InvalidationBus. Handlers run synchronously in
+// Publish, which makes it suitable for tests and single-process setups.
+type MemoryBus struct {
+	handlers []func(key string)
+	closed   bool
+	mutex    sync.RWMutex
+}
+
+// NewMemoryBus creates an in-process invalidation bus
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{}
+}
+
+// Publish delivers key to every handler
+func (b *MemoryBus) Publish(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.mutex.RLock()
+	handlers := b.handlers
+	closed := b.closed
+	b.mutex.RUnlock()
+
+	if closed {
+		return ErrBusClosed
+	}
+	for _, handler := range handlers {
+		handler(key)
+	}
+	return nil
+}
+
+// Subscribe registers a handler for published keys
+func (b *MemoryBus) Subscribe(handler func(key string)) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return ErrBusClosed
+	}
+	b.handlers = append(b.handlers, handler)
+	return nil
+}
+
+// Close stops delivery to all handlers
+func (b *MemoryBus) Close() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.closed = true
+	b.handlers = nil
+	return nil
+}
+
+// RedisBus is an InvalidationBus built on Redis pub/sub
+type RedisBus struct {
+	client  redis.UniversalClient
+	channel string
+
+	handlers []func(key string)
+	pubsub   *redis.PubSub
+	closed   bool
+	mutex    sync.RWMutex
+}
+
+// NewRedisBus creates an invalidation bus publishing on the given channel
+func NewRedisBus(client redis.UniversalClient, channel string) *RedisBus {
+	return &RedisBus{
+		client:  client,
+		channel: channel,
+	}
+}
+
+// Publish sends key to every subscriber of the channel
+func (b *RedisBus) Publish(ctx context.Context, key string) error {
+	return b.client.Publish(ctx, b.channel, key).Err()
+}
+
+// Subscribe registers a handler for published keys. The first call
+// subscribes to the channel and starts delivering messages.
+func (b *RedisBus) Subscribe(handler func(key string)) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return ErrBusClosed
+	}
+	b.handlers = append(b.handlers, handler)
+	if b.pubsub != nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	pubsub := b.client.Subscribe(ctx, b.channel)
+
+	// Wait for the subscription to be confirmed so no message published
+	// after Subscribe returns is missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		b.handlers = b.handlers[:len(b.handlers)-1]
+		return err
+	}
+
+	b.pubsub = pubsub
+	go b.listen(pubsub.Channel())
+
+	return nil
+}
+
+// Close unsubscribes from the channel
+func (b *RedisBus) Close() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.closed = true
+	b.handlers = nil
+	if b.pubsub == nil {
+		return nil
+	}
+	return b.pubsub.Close()
+}
+
+// listen delivers messages until the subscription is closed
+func (b *RedisBus) listen(messages <-chan *redis.Message) {
+	for msg := range messages {
+		b.mutex.RLock()
+		handlers := b.handlers
+		b.mutex.RUnlock()
+
+		for _, handler := range handlers {
+			handler(msg.Payload)
+		}
+	}
+}
@@ -1,34 +1,164 @@
 package cache
 
 import (
+	"context"
+	"crypto/tls"
 	"time"
 )
 
-// Cache defines the interface for caching operations
+// Cache defines the interface for caching operations.
+//
+// The Ctx variants honor the deadline and cancellation of the given context,
+// so a cache call made while serving a request can be bounded by that request.
 type Cache interface {
 	Set(key string, value interface{}, ttl time.Duration) error
 	Get(key string) (interface{}, error)
 	Delete(key string) error
 	Exists(key string) bool
 	Close() error
+
+	SetCtx(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+	GetCtx(ctx context.Context, key string) (interface{}, error)
+	DeleteCtx(ctx context.Context, key string) error
+	ExistsCtx(ctx context.Context, key string) bool
+
+	// SetWithTags stores a value and associates it with tags for bulk invalidation
+	SetWithTags(ctx context.Context, key string, value interface{}, ttl time.Duration, tags []string) error
+	// InvalidateTag removes every key stored with the tag
+	InvalidateTag(ctx context.Context, tag string) error
+	// DeletePrefix removes every key starting with prefix
+	DeletePrefix(ctx context.Context, prefix string) error
+
+	// MGet looks up several keys at once; missing keys are reported per key
+	MGet(ctx context.Context, keys []string) ([]Result, error)
+	// MSet stores several entries at once
+	MSet(ctx context.Context, entries []Entry) error
+	// MDelete removes several keys at once
+	MDelete(ctx context.Context, keys []string) error
+
+	// Incr atomically adds delta to an integer counter, creating it if missing.
+	// ttl is applied if the counter has no expiry yet, so later increments do
+	// not extend a window started by the first one.
+	Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+	// Decr atomically subtracts delta from an integer counter, like Incr
+	Decr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+	// SetNX stores a value only if the key does not exist, reporting whether it was stored
+	SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error)
+	// CompareAndSwap replaces the value only if the current value equals old,
+	// reporting whether it was replaced. Values are compared by their JSON encoding.
+	CompareAndSwap(ctx context.Context, key string, old, new interface{}, ttl time.Duration) (bool, error)
+
+	// Keys returns the keys matching a glob pattern ("*" or "" for all), sorted.
+	// Like Scan, it never blocks a Redis server the way KEYS does.
+	Keys(ctx context.Context, pattern string) ([]string, error)
+	// Scan calls fn for each key matching a glob pattern until fn returns false.
+	// Keys added or removed during the scan may or may not be visited.
+	Scan(ctx context.Context, pattern string, fn func(key string) bool) error
+	// TTL returns the remaining lifetime of key, zero if it never expires, or ErrKeyNotFound
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	// Expire sets the TTL of an existing key, or removes its expiry if ttl is
+	// zero or negative. It returns ErrKeyNotFound if the key does not exist.
+	Expire(ctx context.Context, key string, ttl time.Duration) error
+	// Peek returns the value of key and its remaining lifetime (zero if it
+	// never expires) without counting a hit or miss or changing the key's
+	// eviction order, e.g. for inspecting a cache while debugging
+	Peek(ctx context.Context, key string) (interface{}, time.Duration, error)
+
+	// Stats returns hit, miss, eviction and expiry counters and the item count
+	Stats(ctx context.Context) (Stats, error)
+}
+
+// Entry is a value to store in a batch
+type Entry struct {
+	Key   string
+	Value interface{}
+	TTL   time.Duration
+}
+
+// Result is the outcome of looking up one key in a batch
+type Result struct {
+	Key   string
+	Value interface{}
+	Err   error // ErrKeyNotFound if the key is missing or expired
 }
 
 // Config holds cache configuration
 type Config struct {
-	Type     string // "memory" or "redis"
-	RedisAddr string // Redis server address (e.g., "localhost:6379")
+	Type          string // "memory", "sharded", "redis", "tiered" or "disk"
+	RedisAddr     string // Redis server address (e.g., "localhost:6379") in single mode
 	RedisPassword string // Redis password (optional)
-	RedisDB   int    // Redis database number
+	RedisDB       int    // Redis database number
+
+	// Redis topology; RedisMode is "single" (default), "sentinel" or "cluster"
+	RedisMode             string
+	RedisAddrs            []string // Sentinel or cluster seed addresses; defaults to RedisAddr
+	RedisMasterName       string   // Sentinel master name
+	RedisUsername         string   // Redis ACL username (optional)
+	RedisSentinelPassword string   // Password for the sentinels, if different from RedisPassword
+	RedisTLS              *tls.Config
+
+	// Redis connection pool settings; zero uses the go-redis defaults
+	RedisPoolSize     int
+	RedisMinIdleConns int
+	RedisPoolTimeout  time.Duration
+	RedisIdleTimeout  time.Duration
+	RedisDialTimeout  time.Duration
+	RedisReadTimeout  time.Duration
+	RedisWriteTimeout time.Duration
+
+	// Memory cache limits, also applied to the tiered near cache; zero means unlimited
+	MaxEntries     int    // Maximum number of entries
+	MaxBytes       int64  // Maximum estimated size of keys and values in bytes
+	EvictionPolicy string // "lru" (default), "lfu" or "fifo"
+	Shards         int    // Number of shards for the sharded cache (default 4 per CPU)
+
+	// Memory and disk cache expiry settings
+	CleanupInterval time.Duration // How often expired items are swept (default 5m, negative disables)
+	Clock           Clock         // Time source for TTLs (default wall clock)
+
+	// Disk cache settings
+	DiskPath string // Path of the disk cache log file
+
+	// Key namespacing; when either is set, keys are stored as "namespace:vN:key".
+	// Bumping SchemaVersion hides every entry written under the old version.
+	Namespace     string // Service name prefixed to every key and tag (optional)
+	SchemaVersion int    // Version of the cached payloads (optional)
+
+	// Observer receives an event for every cache operation (optional)
+	Observer Observer
+
+	// Tiered cache settings
+	NearTTL             time.Duration // Maximum lifetime of local copies (default 30s)
+	InvalidationChannel string        // Redis pub/sub channel used to invalidate local copies on every instance (optional)
 }
 
 // New creates a new cache instance based on the configuration
 func New(config Config) (Cache, error) {
+	cache, err := newCache(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Namespace != "" || config.SchemaVersion != 0 {
+		return NewNamespaced(cache, config.Namespace, config.SchemaVersion), nil
+	}
+	return cache, nil
+}
+
+// newCache creates the backend selected by config.Type
+func newCache(config Config) (Cache, error) {
 	switch config.Type {
 	case "redis":
 		return newRedisCache(config)
+	case "tiered":
+		return newTieredCache(config)
+	case "disk":
+		return newDiskCache(config)
+	case "sharded":
+		return newShardedCache(config), nil
 	case "memory":
-		return newMemoryCache(), nil
+		return newMemoryCache(config), nil
 	default:
-		return newMemoryCache(), nil // default to memory
+		return newMemoryCache(config), nil // default to memory
 	}
-}
\ No newline at end of file
+}
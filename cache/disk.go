@@ -0,0 +1,868 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Disk log record operations
+const (
+	diskOpSet    = "set"
+	diskOpDelete = "del"
+)
+
+// Compaction runs once the log holds at least compactMinRecords records and
+// more than compactRatio records per live entry
+const (
+	compactMinRecords = 1000
+	compactRatio      = 2
+)
+
+// diskRecord is one line of the append-only log
+type diskRecord struct {
+	Op         string          `json:"op"`
+	Key        string          `json:"key"`
+	Value      json.RawMessage `json:"value,omitempty"`
+	Expiration int64           `json:"exp,omitempty"` // unix nanoseconds
+	Tags       []string        `json:"tags,omitempty"`
+}
+
+// diskEntry is a live entry; values are kept JSON-encoded, as in Redis
+type diskEntry struct {
+	value      []byte
+	expiration int64
+	tags       []string
+}
+
+// expired reports whether the entry's TTL has passed at now (unix nanoseconds)
+func (e *diskEntry) expired(now int64) bool {
+	return e.expiration > 0 && now >= e.expiration
+}
+
+// DiskCache is a cache persisted to an append-only log on local disk, so
+// entries survive restarts without running Redis. Every write appends a JSON
+// line to the log and the whole cache is kept in memory for reads. The log is
+// compacted automatically once it mostly holds overwritten or deleted entries.
+//
+// Values are stored as JSON and come back decoded like RedisCache values.
+// The log is locked for a single process at a time.
+type DiskCache struct {
+	path     string
+	file     *os.File
+	lockFile *os.File // holds the exclusive lock on the log
+	size     int64    // length of the log up to its last complete record
+	records  int      // records in the log, live or not
+	retryAt  int      // record count before retrying a failed automatic compaction
+	broken   error    // set when a failed append could not be rolled back
+
+	entries   map[string]*diskEntry
+	tags      map[string]map[string]struct{} // tag -> keys
+	usedBytes int64
+	mutex     sync.Mutex
+
+	stats  recorder
+	clock  Clock
+	locker sharedLocker // returned by NewLocker
+
+	stop chan struct{} // stops the cleanup goroutine
+}
+
+// newDiskCache opens or creates the log at config.DiskPath and replays it
+func newDiskCache(config Config) (*DiskCache, error) {
+	if config.DiskPath == "" {
+		return nil, errors.New("cache: disk cache requires DiskPath")
+	}
+
+	cache := &DiskCache{
+		path:    config.DiskPath,
+		entries: make(map[string]*diskEntry),
+		tags:    make(map[string]map[string]struct{}),
+		stats:   recorder{observer: config.Observer},
+		clock:   config.Clock,
+		stop:    make(chan struct{}),
+	}
+	if cache.clock == nil {
+		cache.clock = systemClock{}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cache.path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := cache.lock(); err != nil {
+		return nil, err
+	}
+	if err := cache.load(); err != nil {
+		cache.lockFile.Close()
+		return nil, err
+	}
+
+	interval := config.CleanupInterval
+	if interval == 0 {
+		interval = defaultCleanupInterval
+	}
+	if interval > 0 {
+		go cache.cleanup(interval)
+	}
+
+	return cache, nil
+}
+
+// lock takes an exclusive lock on the log's ".lock" file, held until Close.
+// The lock lives in its own file because compaction replaces the log.
+func (c *DiskCache) lock() error {
+	file, err := os.OpenFile(c.path+".lock", os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		if errors.Is(err, ErrCacheLocked) {
+			return fmt.Errorf("%w: %s", ErrCacheLocked, c.path)
+		}
+		return err
+	}
+	c.lockFile = file
+	return nil
+}
+
+// load replays the log into memory and opens it for appending. An
+// unterminated last record, as left by a crash mid-write, is truncated away;
+// any other record that cannot be parsed fails the load.
+func (c *DiskCache) load() error {
+	file, err := os.OpenFile(c.path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	now := c.now()
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			file.Close()
+			return err
+		}
+
+		var record diskRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			file.Close()
+			return fmt.Errorf("cache: corrupt record on line %d of %s: %w", line, c.path, err)
+		}
+		offset += int64(len(data))
+		c.records++
+		c.apply(record, now)
+	}
+
+	if err := file.Truncate(offset); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return err
+	}
+
+	c.file = file
+	c.size = offset
+	return nil
+}
+
+// apply updates the in-memory state with a record. Callers must hold the
+// mutex or be loading.
+func (c *DiskCache) apply(record diskRecord, now int64) {
+	c.drop(record.Key)
+	if record.Op != diskOpSet {
+		return
+	}
+
+	entry := &diskEntry{
+		value:      record.Value,
+		expiration: record.Expiration,
+		tags:       record.Tags,
+	}
+	if entry.expired(now) {
+		return
+	}
+
+	c.entries[record.Key] = entry
+	c.usedBytes += int64(len(record.Key) + len(entry.value))
+	for _, tag := range entry.tags {
+		keys, ok := c.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			c.tags[tag] = keys
+		}
+		keys[record.Key] = struct{}{}
+	}
+}
+
+// drop removes a key from the in-memory state without logging it. Callers must hold the mutex.
+func (c *DiskCache) drop(key string) {
+	entry, exists := c.entries[key]
+	if !exists {
+		return
+	}
+	c.usedBytes -= int64(len(key) + len(entry.value))
+	delete(c.entries, key)
+
+	for _, tag := range entry.tags {
+		keys := c.tags[tag]
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+}
+
+// write appends records to the log and applies them. Callers must hold the mutex.
+func (c *DiskCache) write(records ...diskRecord) error {
+	if c.file == nil {
+		return ErrCacheClosed
+	}
+	if c.broken != nil {
+		return c.broken
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	if _, err := c.file.Write(buf.Bytes()); err != nil {
+		c.rollback(err)
+		return err
+	}
+	c.size += int64(buf.Len())
+
+	now := c.now()
+	for _, record := range records {
+		c.records++
+		c.apply(record, now)
+	}
+
+	// The records are already persisted, so a failed compaction is reported
+	// to the observer rather than failing the write, and retried once another
+	// compactMinRecords records have been appended
+	if c.records >= compactMinRecords && c.records >= c.retryAt && c.records > compactRatio*len(c.entries) {
+		start := time.Now()
+		err := c.compact()
+		if err != nil {
+			c.retryAt = c.records + compactMinRecords
+		}
+		c.stats.notify(Event{Op: OpCompact, Err: err, Latency: time.Since(start)})
+	}
+	return nil
+}
+
+// rollback cuts a partial append off the log, so it ends with its last
+// complete record again. If that fails too, the cache refuses further writes
+// until a successful Compact rewrites the log. Callers must hold the mutex.
+func (c *DiskCache) rollback(cause error) {
+	err := c.file.Truncate(c.size)
+	if err == nil {
+		_, err = c.file.Seek(c.size, io.SeekStart)
+	}
+	if err != nil {
+		c.broken = fmt.Errorf("cache: disk log unusable after failed write (%v): %w", cause, err)
+	}
+}
+
+// setRecord encodes a value into a set record
+func (c *DiskCache) setRecord(key string, value interface{}, ttl time.Duration, tags []string) (diskRecord, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return diskRecord{}, err
+	}
+
+	record := diskRecord{Op: diskOpSet, Key: key, Value: data, Tags: tags}
+	if ttl > 0 {
+		record.Expiration = c.now() + int64(ttl)
+	}
+	return record, nil
+}
+
+// get returns the live entry for key, dropping it if expired. Callers must hold the mutex.
+func (c *DiskCache) get(key string) (*diskEntry, bool) {
+	entry, exists := c.entries[key]
+	if !exists {
+		return nil, false
+	}
+	if entry.expired(c.now()) {
+		// The expiry is in the log, so replay drops it too
+		c.drop(key)
+		c.stats.expired(key)
+		return nil, false
+	}
+	return entry, true
+}
+
+// Set stores a value on disk with TTL
+func (c *DiskCache) Set(key string, value interface{}, ttl time.Duration) error {
+	return c.SetCtx(context.Background(), key, value, ttl)
+}
+
+// SetCtx stores a value on disk with TTL unless ctx is already done
+func (c *DiskCache) SetCtx(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return c.SetWithTags(ctx, key, value, ttl, nil)
+}
+
+// Get retrieves a value
+func (c *DiskCache) Get(key string) (interface{}, error) {
+	return c.GetCtx(context.Background(), key)
+}
+
+// GetCtx retrieves a value unless ctx is already done
+func (c *DiskCache) GetCtx(ctx context.Context, key string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	c.mutex.Lock()
+	entry, found := c.get(key)
+	c.mutex.Unlock()
+
+	if !found {
+		c.stats.lookup(OpGet, key, ErrKeyNotFound, start)
+		return nil, ErrKeyNotFound
+	}
+	c.stats.lookup(OpGet, key, nil, start)
+	return decodeValue(string(entry.value)), nil
+}
+
+// Delete removes a key
+func (c *DiskCache) Delete(key string) error {
+	return c.DeleteCtx(context.Background(), key)
+}
+
+// DeleteCtx removes a key unless ctx is already done
+func (c *DiskCache) DeleteCtx(ctx context.Context, key string) error {
+	return c.MDelete(ctx, []string{key})
+}
+
+// Exists checks if a key exists
+func (c *DiskCache) Exists(key string) bool {
+	return c.ExistsCtx(context.Background(), key)
+}
+
+// ExistsCtx checks if a key exists; it reports false if ctx is already done
+func (c *DiskCache) ExistsCtx(ctx context.Context, key string) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	_, found := c.get(key)
+	return found
+}
+
+// SetWithTags stores a value with TTL and indexes it under tags
+func (c *DiskCache) SetWithTags(ctx context.Context, key string, value interface{}, ttl time.Duration, tags []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	record, err := c.setRecord(key, value, ttl, tags)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	c.mutex.Lock()
+	err = c.write(record)
+	c.mutex.Unlock()
+
+	c.stats.write(OpSet, key, err, start)
+	return err
+}
+
+// InvalidateTag removes every key stored with the tag
+func (c *DiskCache) InvalidateTag(ctx context.Context, tag string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var records []diskRecord
+	for key := range c.tags[tag] {
+		records = append(records, diskRecord{Op: diskOpDelete, Key: key})
+	}
+	return c.write(records...)
+}
+
+// DeletePrefix removes every key starting with prefix
+func (c *DiskCache) DeletePrefix(ctx context.Context, prefix string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var records []diskRecord
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			records = append(records, diskRecord{Op: diskOpDelete, Key: key})
+		}
+	}
+	return c.write(records...)
+}
+
+// MGet looks up several keys under a single lock
+func (c *DiskCache) MGet(ctx context.Context, keys []string) ([]Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	c.mutex.Lock()
+	results := make([]Result, len(keys))
+	for i, key := range keys {
+		results[i].Key = key
+		if entry, found := c.get(key); found {
+			results[i].Value = entry.value
+		} else {
+			results[i].Err = ErrKeyNotFound
+		}
+	}
+	c.mutex.Unlock()
+
+	for i, result := range results {
+		if result.Err == nil {
+			results[i].Value = decodeValue(string(result.Value.([]byte)))
+		}
+		c.stats.lookup(OpMGet, result.Key, result.Err, start)
+	}
+	return results, nil
+}
+
+// MSet stores several entries with a single log write
+func (c *DiskCache) MSet(ctx context.Context, entries []Entry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	records := make([]diskRecord, len(entries))
+	for i, entry := range entries {
+		record, err := c.setRecord(entry.Key, entry.Value, entry.TTL, nil)
+		if err != nil {
+			return err
+		}
+		records[i] = record
+	}
+
+	start := time.Now()
+	c.mutex.Lock()
+	err := c.write(records...)
+	c.mutex.Unlock()
+
+	for _, entry := range entries {
+		c.stats.write(OpMSet, entry.Key, err, start)
+	}
+	return err
+}
+
+// MDelete removes several keys with a single log write
+func (c *DiskCache) MDelete(ctx context.Context, keys []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	c.mutex.Lock()
+	var records []diskRecord
+	for _, key := range keys {
+		if _, exists := c.entries[key]; exists {
+			records = append(records, diskRecord{Op: diskOpDelete, Key: key})
+		}
+	}
+	err := c.write(records...)
+	c.mutex.Unlock()
+
+	op := OpMDelete
+	if len(keys) == 1 {
+		op = OpDelete
+	}
+	for _, key := range keys {
+		c.stats.remove(op, key, err, start)
+	}
+	return err
+}
+
+// Incr atomically adds delta to an integer counter, creating it if missing
+func (c *DiskCache) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, found := c.get(key)
+	if !found {
+		record, err := c.setRecord(key, delta, ttl, nil)
+		if err != nil {
+			return 0, err
+		}
+		return delta, c.write(record)
+	}
+
+	current, err := strconv.ParseInt(string(entry.value), 10, 64)
+	if err != nil {
+		return 0, ErrNotInteger
+	}
+	current += delta
+
+	// Keep the existing expiry and tags, and only start a window if there is none
+	record := diskRecord{
+		Op:         diskOpSet,
+		Key:        key,
+		Value:      []byte(strconv.FormatInt(current, 10)),
+		Expiration: entry.expiration,
+		Tags:       entry.tags,
+	}
+	if record.Expiration == 0 && ttl > 0 {
+		record.Expiration = c.now() + int64(ttl)
+	}
+	return current, c.write(record)
+}
+
+// Decr atomically subtracts delta from an integer counter, creating it if missing
+func (c *DiskCache) Decr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	return c.Incr(ctx, key, -delta, ttl)
+}
+
+// SetNX stores a value only if the key does not exist
+func (c *DiskCache) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	record, err := c.setRecord(key, value, ttl, nil)
+	if err != nil {
+		return false, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, found := c.get(key); found {
+		return false, nil
+	}
+	return true, c.write(record)
+}
+
+// CompareAndSwap replaces the value only if the stored JSON decodes to the
+// same value as the JSON encoding of old. The key keeps its tags.
+func (c *DiskCache) CompareAndSwap(ctx context.Context, key string, old, new interface{}, ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	expected, err := json.Marshal(old)
+	if err != nil {
+		return false, err
+	}
+	record, err := c.setRecord(key, new, ttl, nil)
+	if err != nil {
+		return false, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, found := c.get(key)
+	if !found || !sameJSON(entry.value, expected) {
+		return false, nil
+	}
+	record.Tags = entry.tags
+	return true, c.write(record)
+}
+
+// Keys returns the live keys matching pattern, sorted
+func (c *DiskCache) Keys(ctx context.Context, pattern string) ([]string, error) {
+	return collectKeys(ctx, c.Scan, pattern)
+}
+
+// Scan calls fn for each live key matching pattern, in sorted order
+func (c *DiskCache) Scan(ctx context.Context, pattern string, fn func(key string) bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if pattern == "" {
+		pattern = "*"
+	}
+
+	c.mutex.Lock()
+	now := c.now()
+	var keys []string
+	for key, entry := range c.entries {
+		if !entry.expired(now) && matchPattern(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	c.mutex.Unlock()
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !fn(key) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// TTL returns the remaining lifetime of key, zero if it never expires
+func (c *DiskCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, found := c.get(key)
+	if !found {
+		return 0, ErrKeyNotFound
+	}
+	if entry.expiration == 0 {
+		return 0, nil
+	}
+	return time.Duration(entry.expiration - c.now()), nil
+}
+
+// Peek returns the value and remaining lifetime of key, leaving stats untouched
+func (c *DiskCache) Peek(ctx context.Context, key string) (interface{}, time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, exists := c.entries[key]
+	now := c.now()
+	if !exists || entry.expired(now) {
+		return nil, 0, ErrKeyNotFound
+	}
+	var ttl time.Duration
+	if entry.expiration > 0 {
+		ttl = time.Duration(entry.expiration - now)
+	}
+	return decodeValue(string(entry.value)), ttl, nil
+}
+
+// Expire sets the TTL of an existing key, or removes its expiry if ttl is not positive
+func (c *DiskCache) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, found := c.get(key)
+	if !found {
+		return ErrKeyNotFound
+	}
+
+	record := diskRecord{Op: diskOpSet, Key: key, Value: entry.value, Tags: entry.tags}
+	if ttl > 0 {
+		record.Expiration = c.now() + int64(ttl)
+	}
+	return c.write(record)
+}
+
+// Stats returns the cache counters along with the current item count and size
+func (c *DiskCache) Stats(ctx context.Context) (Stats, error) {
+	if err := ctx.Err(); err != nil {
+		return Stats{}, err
+	}
+
+	stats := c.stats.snapshot()
+
+	c.mutex.Lock()
+	stats.Items = int64(len(c.entries))
+	stats.Bytes = c.usedBytes
+	c.mutex.Unlock()
+
+	return stats, nil
+}
+
+// Compact rewrites the log with only the live entries
+func (c *DiskCache) Compact() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.file == nil {
+		return ErrCacheClosed
+	}
+	return c.compact()
+}
+
+// compact drops expired entries, writes the live ones to a temporary file
+// and atomically replaces the log with it. Callers must hold the mutex.
+func (c *DiskCache) compact() error {
+	c.deleteExpired()
+
+	tmpPath := c.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	records := 0
+	for key, entry := range c.entries {
+		record := diskRecord{
+			Op:         diskOpSet,
+			Key:        key,
+			Value:      entry.value,
+			Expiration: entry.expiration,
+			Tags:       entry.tags,
+		}
+		if err := encoder.Encode(record); err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+			return err
+		}
+		records++
+	}
+
+	if err := writer.Flush(); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, c.path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	file, err := os.OpenFile(c.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err == nil {
+		var info os.FileInfo
+		if info, err = file.Stat(); err == nil {
+			c.size = info.Size()
+		} else {
+			file.Close()
+		}
+	}
+	if err != nil {
+		c.file.Close()
+		c.file = nil
+		return err
+	}
+	c.file.Close()
+	c.file = file
+	c.records = records
+	c.retryAt = 0
+	c.broken = nil
+	return nil
+}
+
+// Close flushes the log to disk and closes it
+func (c *DiskCache) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.lockFile == nil {
+		return nil
+	}
+	close(c.stop)
+
+	// A failed compaction may already have closed the log
+	var err error
+	if c.file != nil {
+		err = c.file.Sync()
+		if closeErr := c.file.Close(); err == nil {
+			err = closeErr
+		}
+		c.file = nil
+	}
+
+	// Closing the lock file releases the lock
+	if closeErr := c.lockFile.Close(); err == nil {
+		err = closeErr
+	}
+	c.lockFile = nil
+	return err
+}
+
+// DeleteExpired drops every expired entry from memory, as the cleanup
+// goroutine does on each tick. Their expiry is already in the log, so
+// nothing is written.
+func (c *DiskCache) DeleteExpired() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.deleteExpired()
+}
+
+// deleteExpired drops every expired entry. Callers must hold the mutex.
+func (c *DiskCache) deleteExpired() {
+	now := c.now()
+	for key, entry := range c.entries {
+		if entry.expired(now) {
+			c.drop(key)
+			c.stats.expired(key)
+		}
+	}
+}
+
+// cleanup periodically drops expired entries until Close
+func (c *DiskCache) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.DeleteExpired()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// now returns the current time in unix nanoseconds
+func (c *DiskCache) now() int64 {
+	return c.clock.Now().UnixNano()
+}
+
+// timeSource returns the Clock the cache keeps time with
+func (c *DiskCache) timeSource() Clock {
+	return c.clock
+}
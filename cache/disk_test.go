@@ -0,0 +1,250 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestDiskCache opens a disk cache on path, closing it when the test ends
+func newTestDiskCache(t *testing.T, path string) *DiskCache {
+	t.Helper()
+	c, err := newDiskCache(Config{DiskPath: path})
+	if err != nil {
+		t.Fatalf("newDiskCache: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestDiskCacheTruncatesPartialRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+	complete := `{"op":"set","key":"a","value":"1"}` + "\n"
+	if err := os.WriteFile(path, []byte(complete+`{"op":"set","key":"b","val`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestDiskCache(t, path)
+	if value, err := c.Get("a"); err != nil || value != "1" {
+		t.Errorf("Get(a) = %v, %v, want 1", value, err)
+	}
+	if c.Exists("b") {
+		t.Error("partial record was loaded")
+	}
+
+	if err := c.Set("c", "3", 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	c.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := complete + `{"op":"set","key":"c","value":"3"}` + "\n"; string(data) != want {
+		t.Errorf("log = %q, want %q", data, want)
+	}
+}
+
+func TestDiskCacheRejectsCorruptRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+	log := `{"op":"set","key":"a","value":"1"}` + "\n" +
+		"not json\n" +
+		`{"op":"set","key":"b","value":"2"}` + "\n"
+	if err := os.WriteFile(path, []byte(log), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := newDiskCache(Config{DiskPath: path})
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("newDiskCache = %v, want a corrupt record error for line 2", err)
+	}
+
+	// The log is left untouched and unlocked
+	if data, _ := os.ReadFile(path); string(data) != log {
+		t.Errorf("log was modified: %q", data)
+	}
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	newTestDiskCache(t, path)
+}
+
+func TestDiskCacheLocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+	c := newTestDiskCache(t, path)
+	if err := c.Set("a", 1, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newDiskCache(Config{DiskPath: path}); !errors.Is(err, ErrCacheLocked) {
+		t.Fatalf("second open = %v, want ErrCacheLocked", err)
+	}
+
+	// Compaction replaces the log but keeps it locked
+	if err := c.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if _, err := newDiskCache(Config{DiskPath: path}); !errors.Is(err, ErrCacheLocked) {
+		t.Fatalf("open after Compact = %v, want ErrCacheLocked", err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	reopened := newTestDiskCache(t, path)
+	if !reopened.Exists("a") {
+		t.Error("entry lost across reopen")
+	}
+}
+
+func TestDiskCacheFailedWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+	c := newTestDiskCache(t, path)
+	if err := c.Set("a", 1, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// A read-only handle fails the append and the rollback alike
+	readOnly, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.mutex.Lock()
+	c.file.Close()
+	c.file = readOnly
+	c.mutex.Unlock()
+
+	if err := c.Set("b", 2, 0); err == nil {
+		t.Fatal("Set succeeded on a read-only log")
+	}
+	if err := c.Set("c", 3, 0); err == nil || !strings.Contains(err.Error(), "unusable") {
+		t.Fatalf("Set after failed rollback = %v, want the log to be marked unusable", err)
+	}
+	if c.Exists("b") {
+		t.Error("failed write was applied")
+	}
+
+	// Compact rewrites the log from memory and clears the failure
+	if err := c.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if err := c.Set("c", 3, 0); err != nil {
+		t.Fatalf("Set after Compact: %v", err)
+	}
+	c.Close()
+
+	reopened := newTestDiskCache(t, path)
+	if !reopened.Exists("a") || !reopened.Exists("c") || reopened.Exists("b") {
+		t.Error("log does not hold exactly a and c after reopen")
+	}
+}
+
+func TestDiskCacheDeleteExpired(t *testing.T) {
+	clock := NewManualClock(time.Unix(1700000000, 0))
+	c, err := newDiskCache(Config{DiskPath: filepath.Join(t.TempDir(), "cache.log"), Clock: clock, CleanupInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	for i := 0; i < 10; i++ {
+		c.Set(fmt.Sprintf("session:%d", i), i, time.Minute)
+	}
+	c.Set("config", "kept", 0)
+	clock.Advance(2 * time.Minute)
+
+	// Expired entries that are never read again are swept all the same
+	c.DeleteExpired()
+	c.mutex.Lock()
+	remaining := len(c.entries)
+	c.mutex.Unlock()
+	if remaining != 1 {
+		t.Errorf("%d entries in memory after DeleteExpired, want 1", remaining)
+	}
+	stats, _ := c.Stats(context.Background())
+	if stats.Expirations != 10 || stats.Items != 1 {
+		t.Errorf("Expirations = %d, Items = %d; want 10, 1", stats.Expirations, stats.Items)
+	}
+}
+
+func TestDiskCacheCompactDropsExpired(t *testing.T) {
+	clock := NewManualClock(time.Unix(1700000000, 0))
+	path := filepath.Join(t.TempDir(), "cache.log")
+	c, err := newDiskCache(Config{DiskPath: path, Clock: clock, CleanupInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	c.Set("short", 1, time.Minute)
+	c.Set("long", 2, time.Hour)
+	clock.Advance(2 * time.Minute)
+
+	if err := c.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	c.mutex.Lock()
+	_, kept := c.entries["short"]
+	records := c.records
+	c.mutex.Unlock()
+	if kept || records != 1 {
+		t.Errorf("after Compact: short in memory = %v, records = %d; want false, 1", kept, records)
+	}
+}
+
+func TestDiskCacheFailedCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+	var compactions []error
+	observer := ObserverFunc(func(event Event) {
+		if event.Op == OpCompact {
+			compactions = append(compactions, event.Err)
+		}
+	})
+	c, err := newDiskCache(Config{DiskPath: path, Observer: observer, CleanupInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	// A directory in the way of the temporary file makes compaction fail
+	if err := os.Mkdir(path+".tmp", 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < compactMinRecords; i++ {
+		if err := c.Set("counter", i, 0); err != nil {
+			t.Fatalf("Set %d: %v", i, err)
+		}
+	}
+	if len(compactions) != 1 || compactions[0] == nil {
+		t.Fatalf("compaction events = %v, want one failure", compactions)
+	}
+
+	// Further writes do not retry until another compactMinRecords records
+	for i := 0; i < compactMinRecords-1; i++ {
+		c.Set("counter", i, 0)
+	}
+	if len(compactions) != 1 {
+		t.Fatalf("%d compaction attempts, want the retry deferred", len(compactions))
+	}
+
+	os.Remove(path + ".tmp")
+	if err := c.Set("counter", "last", 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if len(compactions) != 2 || compactions[1] != nil {
+		t.Fatalf("compaction events = %v, want the retry to succeed", compactions)
+	}
+	c.Close()
+
+	reopened := newTestDiskCache(t, path)
+	if value, err := reopened.Get("counter"); err != nil || value != "last" {
+		t.Errorf("Get after reopen = %v, %v; want last", value, err)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+
+package cache
+
+import "os"
+
+// lockFile is a no-op where flock is unavailable, so sharing a log between
+// processes is not detected there
+func lockFile(file *os.File) error {
+	return nil
+}
@@ -5,4 +5,11 @@ import "errors"
 // Common cache errors
 var (
 	ErrKeyNotFound = errors.New("key not found")
-)
\ No newline at end of file
+	ErrBusClosed   = errors.New("invalidation bus closed")
+	ErrCacheClosed = errors.New("cache closed")
+	ErrCacheLocked = errors.New("cache file is locked by another process")
+	ErrNotInteger  = errors.New("value is not an integer")
+	ErrLockHeld    = errors.New("lock is held by another owner")
+	ErrLockNotHeld = errors.New("lock is not held")
+	ErrInvalidTTL  = errors.New("lock ttl must be positive")
+)
@@ -0,0 +1,29 @@
+package cache
+
+// RemovalReason says why an entry left the cache without being deleted
+type RemovalReason string
+
+// Removal reasons
+const (
+	RemovalEvicted RemovalReason = "evicted" // dropped to respect a size limit
+	RemovalExpired RemovalReason = "expired" // its TTL passed
+)
+
+// RemovalEvent describes an entry that was evicted or expired
+type RemovalEvent struct {
+	Key    string
+	Value  interface{} // nil where the backend no longer has it, as with Redis
+	Reason RemovalReason
+}
+
+// RemovalFunc is called for every evicted or expired entry
+type RemovalFunc func(event RemovalEvent)
+
+// RemovalNotifier is implemented by caches that can report evicted and
+// expired entries, e.g. to audit session expiry
+type RemovalNotifier interface {
+	// OnEvict registers fn to be called for every evicted entry
+	OnEvict(fn RemovalFunc) error
+	// OnExpire registers fn to be called for every expired entry
+	OnExpire(fn RemovalFunc) error
+}
@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"container/heap"
+	"container/list"
+)
+
+// Eviction policies supported by the memory cache
+const (
+	EvictionLRU  = "lru"  // evict the least recently used entry
+	EvictionLFU  = "lfu"  // evict the least frequently used entry
+	EvictionFIFO = "fifo" // evict the oldest inserted entry
+)
+
+// evictionPolicy tracks key usage and picks the next key to evict.
+// Implementations are not safe for concurrent use; callers hold the cache lock.
+type evictionPolicy interface {
+	add(key string)
+	access(key string)
+	remove(key string)
+	victim() (string, bool)
+}
+
+// newEvictionPolicy returns the policy for the given name, defaulting to LRU
+func newEvictionPolicy(name string) evictionPolicy {
+	switch name {
+	case EvictionLFU:
+		return newLFUPolicy()
+	case EvictionFIFO:
+		return &listPolicy{order: list.New(), elements: make(map[string]*list.Element)}
+	default:
+		return &listPolicy{order: list.New(), elements: make(map[string]*list.Element), moveOnAccess: true}
+	}
+}
+
+// listPolicy keeps keys in a list with the eviction candidate at the back.
+// With moveOnAccess it behaves as LRU, otherwise as FIFO.
+type listPolicy struct {
+	order        *list.List
+	elements     map[string]*list.Element
+	moveOnAccess bool
+}
+
+func (p *listPolicy) add(key string) {
+	if el, ok := p.elements[key]; ok {
+		if p.moveOnAccess {
+			p.order.MoveToFront(el)
+		}
+		return
+	}
+	p.elements[key] = p.order.PushFront(key)
+}
+
+func (p *listPolicy) access(key string) {
+	if !p.moveOnAccess {
+		return
+	}
+	if el, ok := p.elements[key]; ok {
+		p.order.MoveToFront(el)
+	}
+}
+
+func (p *listPolicy) remove(key string) {
+	if el, ok := p.elements[key]; ok {
+		p.order.Remove(el)
+		delete(p.elements, key)
+	}
+}
+
+func (p *listPolicy) victim() (string, bool) {
+	el := p.order.Back()
+	if el == nil {
+		return "", false
+	}
+	return el.Value.(string), true
+}
+
+// lfuEntry is a key tracked by the LFU policy
+type lfuEntry struct {
+	key   string
+	freq  uint64
+	seq   uint64 // insertion order, breaks ties between equal frequencies
+	index int
+}
+
+// lfuHeap is a min-heap of entries ordered by frequency, then age
+type lfuHeap []*lfuEntry
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].freq == h[j].freq {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].freq < h[j].freq
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x interface{}) {
+	entry := x.(*lfuEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return entry
+}
+
+// lfuPolicy evicts the least frequently used key
+type lfuPolicy struct {
+	heap    lfuHeap
+	entries map[string]*lfuEntry
+	seq     uint64
+}
+
+func newLFUPolicy() *lfuPolicy {
+	return &lfuPolicy{entries: make(map[string]*lfuEntry)}
+}
+
+func (p *lfuPolicy) add(key string) {
+	if _, ok := p.entries[key]; ok {
+		p.access(key)
+		return
+	}
+	p.seq++
+	entry := &lfuEntry{key: key, freq: 1, seq: p.seq}
+	heap.Push(&p.heap, entry)
+	p.entries[key] = entry
+}
+
+func (p *lfuPolicy) access(key string) {
+	if entry, ok := p.entries[key]; ok {
+		entry.freq++
+		heap.Fix(&p.heap, entry.index)
+	}
+}
+
+func (p *lfuPolicy) remove(key string) {
+	if entry, ok := p.entries[key]; ok {
+		heap.Remove(&p.heap, entry.index)
+		delete(p.entries, key)
+	}
+}
+
+func (p *lfuPolicy) victim() (string, bool) {
+	if len(p.heap) == 0 {
+		return "", false
+	}
+	return p.heap[0].key, true
+}
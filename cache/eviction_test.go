@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// newTestMemoryCache returns a memory cache without a cleanup goroutine
+func newTestMemoryCache(t *testing.T, config Config) *MemoryCache {
+	t.Helper()
+	config.CleanupInterval = -1
+	c := newMemoryCache(config)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// assertKeys checks which of keys are present in c
+func assertKeys(t *testing.T, c Cache, present []string, absent []string) {
+	t.Helper()
+	for _, key := range present {
+		if _, _, err := c.Peek(context.Background(), key); err != nil {
+			t.Errorf("key %q was evicted", key)
+		}
+	}
+	for _, key := range absent {
+		if _, _, err := c.Peek(context.Background(), key); err == nil {
+			t.Errorf("key %q was not evicted", key)
+		}
+	}
+}
+
+// assertEvictions checks the eviction counter reported by Stats
+func assertEvictions(t *testing.T, c Cache, want uint64) {
+	t.Helper()
+	stats, err := c.Stats(context.Background())
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	if stats.Evictions != want {
+		t.Errorf("Evictions = %d, want %d", stats.Evictions, want)
+	}
+}
+
+func TestEvictionLRU(t *testing.T) {
+	c := newTestMemoryCache(t, Config{MaxEntries: 3, EvictionPolicy: EvictionLRU})
+	for _, key := range []string{"a", "b", "c"} {
+		c.Set(key, key, 0)
+	}
+
+	// Reading a makes b the least recently used
+	c.Get("a")
+	c.Set("d", "d", 0)
+	assertKeys(t, c, []string{"a", "c", "d"}, []string{"b"})
+
+	// Overwriting c counts as a use, leaving a the oldest
+	c.Set("c", "c2", 0)
+	c.Set("e", "e", 0)
+	assertKeys(t, c, []string{"c", "d", "e"}, []string{"a"})
+	assertEvictions(t, c, 2)
+}
+
+func TestEvictionFIFO(t *testing.T) {
+	c := newTestMemoryCache(t, Config{MaxEntries: 3, EvictionPolicy: EvictionFIFO})
+	for _, key := range []string{"a", "b", "c"} {
+		c.Set(key, key, 0)
+	}
+
+	// Neither reads nor overwrites change the insertion order
+	c.Get("a")
+	c.Set("a", "a2", 0)
+	c.Set("d", "d", 0)
+	assertKeys(t, c, []string{"b", "c", "d"}, []string{"a"})
+
+	c.Get("b")
+	c.Set("e", "e", 0)
+	assertKeys(t, c, []string{"c", "d", "e"}, []string{"b"})
+	assertEvictions(t, c, 2)
+}
+
+func TestEvictionLFU(t *testing.T) {
+	c := newTestMemoryCache(t, Config{MaxEntries: 3, EvictionPolicy: EvictionLFU})
+	for _, key := range []string{"a", "b", "c"} {
+		c.Set(key, key, 0)
+	}
+
+	c.Get("a")
+	c.Get("a")
+	c.Get("c")
+	c.Set("d", "d", 0)
+	assertKeys(t, c, []string{"a", "c", "d"}, []string{"b"})
+
+	// A new key starts at the lowest frequency, so once every other key
+	// has been read it is the next victim itself
+	c.Get("d")
+	c.Set("e", "e", 0)
+	assertKeys(t, c, []string{"a", "c", "d"}, []string{"e"})
+
+	assertEvictions(t, c, 2)
+}
+
+func TestEvictionLFUTiesByAge(t *testing.T) {
+	c := newTestMemoryCache(t, Config{MaxEntries: 3, EvictionPolicy: EvictionLFU})
+	for _, key := range []string{"a", "b", "c"} {
+		c.Set(key, key, 0)
+	}
+
+	// Every key has been used once, including the new one; the oldest goes first
+	c.Set("d", "d", 0)
+	assertKeys(t, c, []string{"b", "c", "d"}, []string{"a"})
+
+	c.Set("e", "e", 0)
+	assertKeys(t, c, []string{"c", "d", "e"}, []string{"b"})
+}
+
+func TestEvictionMaxBytes(t *testing.T) {
+	// Each entry is a 1-byte key and a 9-byte value
+	c := newTestMemoryCache(t, Config{MaxBytes: 25})
+	value := strings.Repeat("x", 9)
+	c.Set("a", value, 0)
+	c.Set("b", value, 0)
+
+	stats, _ := c.Stats(context.Background())
+	if stats.Bytes != 20 || stats.Items != 2 {
+		t.Fatalf("Bytes = %d, Items = %d; want 20, 2", stats.Bytes, stats.Items)
+	}
+
+	c.Set("c", value, 0)
+	assertKeys(t, c, []string{"b", "c"}, []string{"a"})
+
+	// Replacing a value releases the old size before checking the limit
+	c.Set("c", "y", 0)
+	stats, _ = c.Stats(context.Background())
+	if stats.Bytes != 12 {
+		t.Errorf("Bytes = %d after replacing c, want 12", stats.Bytes)
+	}
+
+	// An entry larger than the limit evicts everything, itself included
+	c.Set("big", strings.Repeat("x", 30), 0)
+	stats, _ = c.Stats(context.Background())
+	if stats.Items != 0 || stats.Bytes != 0 {
+		t.Errorf("Items = %d, Bytes = %d after an oversized Set; want 0, 0", stats.Items, stats.Bytes)
+	}
+	assertEvictions(t, c, 4)
+}
+
+func TestEvictionDeleteReleasesBytes(t *testing.T) {
+	c := newTestMemoryCache(t, Config{MaxBytes: 25})
+	c.Set("a", strings.Repeat("x", 9), 0)
+	c.Delete("a")
+
+	stats, _ := c.Stats(context.Background())
+	if stats.Bytes != 0 || stats.Evictions != 0 {
+		t.Errorf("Bytes = %d, Evictions = %d after Delete; want 0, 0", stats.Bytes, stats.Evictions)
+	}
+}
@@ -0,0 +1,183 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Keyevent channels carrying expired and evicted keys of a database
+const (
+	expiredEventChannel = "__keyevent@%d__:expired"
+	evictedEventChannel = "__keyevent@%d__:evicted"
+)
+
+// keyspaceEventFlags are the notify-keyspace-events flags OnExpire and
+// OnEvict rely on: keyevent notifications (E) for expired (x) and evicted (e) keys
+const keyspaceEventFlags = "Exe"
+
+// redisListeners holds the removal listeners of a RedisCache and the
+// keyevent subscriptions feeding them
+type redisListeners struct {
+	onEvict  []RemovalFunc
+	onExpire []RemovalFunc
+	pubsubs  []*redis.PubSub
+	mutex    sync.RWMutex
+}
+
+// OnEvict registers fn to be called with the key of every entry Redis evicts
+// under its maxmemory policy. Redis must publish evicted keyevent
+// notifications; see EnableKeyspaceEvents.
+func (c *RedisCache) OnEvict(fn RemovalFunc) error {
+	return c.addListener(RemovalEvicted, fn)
+}
+
+// OnExpire registers fn to be called with the key of every entry Redis
+// expires. Redis must publish expired keyevent notifications; see
+// EnableKeyspaceEvents. Notifications are sent when Redis deletes the key,
+// which may be a little after its TTL passed.
+func (c *RedisCache) OnExpire(fn RemovalFunc) error {
+	return c.addListener(RemovalExpired, fn)
+}
+
+// EnableKeyspaceEvents turns on the keyevent notifications OnExpire and
+// OnEvict rely on, keeping any flags already set. It needs the CONFIG
+// command, which managed Redis services often withhold; configure
+// notify-keyspace-events there instead.
+func (c *RedisCache) EnableKeyspaceEvents(ctx context.Context) error {
+	if cluster, ok := c.client.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return enableKeyspaceEvents(ctx, node)
+		})
+	}
+	return enableKeyspaceEvents(ctx, c.client)
+}
+
+// addListener registers fn for reason. The first listener subscribes to the
+// keyevent channels.
+func (c *RedisCache) addListener(reason RemovalReason, fn RemovalFunc) error {
+	l := &c.listeners
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if len(l.pubsubs) == 0 {
+		pubsubs, err := c.subscribeKeyEvents()
+		if err != nil {
+			return err
+		}
+		l.pubsubs = pubsubs
+	}
+
+	if reason == RemovalEvicted {
+		l.onEvict = append(l.onEvict, fn)
+	} else {
+		l.onExpire = append(l.onExpire, fn)
+	}
+	return nil
+}
+
+// subscribeKeyEvents subscribes to the expired and evicted keyevent channels.
+// Notifications are local to a node, so in cluster mode every master is
+// subscribed; masters added later are not.
+func (c *RedisCache) subscribeKeyEvents() ([]*redis.PubSub, error) {
+	db := 0
+	if client, ok := c.client.(*redis.Client); ok {
+		db = client.Options().DB
+	}
+	channels := []string{fmt.Sprintf(expiredEventChannel, db), fmt.Sprintf(evictedEventChannel, db)}
+
+	var pubsubs []*redis.PubSub
+	var mutex sync.Mutex
+	subscribe := func(ctx context.Context, client redis.UniversalClient) error {
+		pubsub := client.Subscribe(ctx, channels...)
+
+		// Wait for the subscription to be confirmed so no removal after
+		// OnExpire or OnEvict returns is missed
+		if _, err := pubsub.Receive(ctx); err != nil {
+			pubsub.Close()
+			return err
+		}
+
+		mutex.Lock()
+		pubsubs = append(pubsubs, pubsub)
+		mutex.Unlock()
+		return nil
+	}
+
+	var err error
+	ctx := context.Background()
+	if cluster, ok := c.client.(*redis.ClusterClient); ok {
+		err = cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return subscribe(ctx, node)
+		})
+	} else {
+		err = subscribe(ctx, c.client)
+	}
+
+	if err != nil {
+		for _, pubsub := range pubsubs {
+			pubsub.Close()
+		}
+		return nil, err
+	}
+
+	for _, pubsub := range pubsubs {
+		go c.deliverKeyEvents(pubsub.Channel())
+	}
+	return pubsubs, nil
+}
+
+// deliverKeyEvents passes keyevent notifications to the listeners until the
+// subscription is closed
+func (c *RedisCache) deliverKeyEvents(messages <-chan *redis.Message) {
+	l := &c.listeners
+	for msg := range messages {
+		event := RemovalEvent{Key: msg.Payload, Reason: RemovalExpired}
+
+		l.mutex.RLock()
+		listeners := l.onExpire
+		if strings.HasSuffix(msg.Channel, ":evicted") {
+			event.Reason = RemovalEvicted
+			listeners = l.onEvict
+		}
+		l.mutex.RUnlock()
+
+		for _, fn := range listeners {
+			fn(event)
+		}
+	}
+}
+
+// closeListeners closes the keyevent subscriptions
+func (c *RedisCache) closeListeners() {
+	l := &c.listeners
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for _, pubsub := range l.pubsubs {
+		pubsub.Close()
+	}
+	l.pubsubs = nil
+}
+
+// enableKeyspaceEvents adds keyspaceEventFlags to one node's notify-keyspace-events
+func enableKeyspaceEvents(ctx context.Context, client redis.UniversalClient) error {
+	current, err := client.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err != nil {
+		return err
+	}
+
+	var flags string
+	if len(current) == 2 {
+		flags, _ = current[1].(string)
+	}
+	for _, flag := range keyspaceEventFlags {
+		if !strings.ContainsRune(flags, flag) {
+			flags += string(flag)
+		}
+	}
+	return client.ConfigSet(ctx, "notify-keyspace-events", flags).Err()
+}
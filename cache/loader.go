@@ -0,0 +1,295 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// notFoundMarker is stored in place of a value to remember that the source
+// has no entry for a key. A plain string survives every backend unchanged.
+const notFoundMarker = "__cache_not_found__"
+
+// defaultLoadTimeout is used when LoaderConfig.LoadTimeout is not set
+const defaultLoadTimeout = 30 * time.Second
+
+// LoadFunc fetches the value for a key from the source of truth. Returning
+// an error that wraps ErrKeyNotFound marks the key as missing.
+type LoadFunc func(ctx context.Context) (interface{}, error)
+
+// LoaderConfig holds read-through loader configuration
+type LoaderConfig struct {
+	// NegativeTTL is how long a not-found result is cached; zero disables negative caching
+	NegativeTTL time.Duration
+
+	// Tags are attached to every entry the loader stores, including not-found results
+	Tags []string
+
+	// LoadTimeout bounds each shared call to the LoadFunc (default 30s). The
+	// call does not use any caller's context, so one caller giving up does
+	// not fail the others waiting on it.
+	LoadTimeout time.Duration
+
+	// StaleTTL enables stale-while-revalidate. A value older than the ttl
+	// passed to GetOrLoad is still served for up to StaleTTL more while a
+	// background call to the LoadFunc refreshes it; zero disables it.
+	StaleTTL time.Duration
+
+	// RefreshAhead enables refresh-ahead. A value read within RefreshAhead
+	// of its ttl is served as usual while a background call to the LoadFunc
+	// reloads it, so hot keys are replaced before they go stale or expire;
+	// zero disables it.
+	RefreshAhead time.Duration
+
+	// RefreshTimeout bounds each background refresh (default LoadTimeout)
+	RefreshTimeout time.Duration
+
+	// OnRefreshError is called when a background refresh fails (optional)
+	OnRefreshError func(key string, err error)
+
+	// Clock decides when values are due for a refresh. It defaults to the
+	// cache's own Clock for the memory, sharded and disk caches, and to the
+	// wall clock otherwise.
+	Clock Clock
+}
+
+// Loader implements read-through caching on top of any Cache.
+// Concurrent misses and background refreshes for the same key share a
+// single call to the LoadFunc.
+type Loader struct {
+	cache  Cache
+	config LoaderConfig
+
+	mutex sync.Mutex
+	calls map[string]*loadCall
+}
+
+// clocked is implemented by caches that keep time with a Clock
+type clocked interface {
+	timeSource() Clock
+}
+
+// loadCall is an in-flight or completed LoadFunc call
+type loadCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// NewLoader creates a read-through loader backed by cache
+func NewLoader(cache Cache, config LoaderConfig) *Loader {
+	if config.LoadTimeout <= 0 {
+		config.LoadTimeout = defaultLoadTimeout
+	}
+	if config.RefreshTimeout <= 0 {
+		config.RefreshTimeout = config.LoadTimeout
+	}
+	if config.Clock == nil {
+		if c, ok := cache.(clocked); ok {
+			config.Clock = c.timeSource()
+		} else {
+			config.Clock = systemClock{}
+		}
+	}
+	return &Loader{
+		cache:  cache,
+		config: config,
+		calls:  make(map[string]*loadCall),
+	}
+}
+
+// GetOrLoad returns the cached value for key, calling load on a miss and
+// caching its result for ttl
+func (l *Loader) GetOrLoad(key string, ttl time.Duration, load LoadFunc) (interface{}, error) {
+	return l.GetOrLoadCtx(context.Background(), key, ttl, load)
+}
+
+// GetOrLoadCtx is GetOrLoad bounded by ctx. Every caller, including the one
+// that started the load, stops waiting when its own ctx is done; the load
+// itself carries on for the others.
+func (l *Loader) GetOrLoadCtx(ctx context.Context, key string, ttl time.Duration, load LoadFunc) (interface{}, error) {
+	if value, err := l.cache.GetCtx(ctx, key); err == nil {
+		if value == notFoundMarker {
+			return nil, ErrKeyNotFound
+		}
+		if !l.wraps() {
+			return value, nil
+		}
+		// Values cached before StaleTTL or RefreshAhead was enabled are not wrapped and are reloaded
+		if entry, ok := unwrapStale(value); ok {
+			if entry.stale(l.config.Clock.Now().Add(l.config.RefreshAhead)) {
+				l.start(ctx, key, ttl, load, true)
+			}
+			return entry.Value, nil
+		}
+	}
+
+	call := l.start(ctx, key, ttl, load, false)
+
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// start returns the in-flight call for key, starting one if there is none.
+// A background refresh and a foreground miss of the same key share a call.
+func (l *Loader) start(ctx context.Context, key string, ttl time.Duration, load LoadFunc, refresh bool) *loadCall {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	call, inFlight := l.calls[key]
+	if !inFlight {
+		call = &loadCall{done: make(chan struct{})}
+		l.calls[key] = call
+		go l.run(ctx, key, ttl, load, call, refresh)
+	}
+	return call
+}
+
+// run performs a shared load on a context detached from the caller that
+// started it, and always releases the key, even if the LoadFunc panics
+func (l *Loader) run(parent context.Context, key string, ttl time.Duration, load LoadFunc, call *loadCall, refresh bool) {
+	timeout := l.config.LoadTimeout
+	if refresh {
+		timeout = l.config.RefreshTimeout
+	}
+	ctx, cancel := context.WithTimeout(detachedContext{parent}, timeout)
+
+	defer func() {
+		if r := recover(); r != nil {
+			call.value, call.err = nil, fmt.Errorf("cache: load of %q panicked: %v", key, r)
+		}
+		if refresh {
+			l.refreshed(ctx, key, call.err)
+		}
+		cancel()
+
+		l.mutex.Lock()
+		delete(l.calls, key)
+		l.mutex.Unlock()
+		close(call.done)
+	}()
+
+	call.value, call.err = l.load(ctx, key, ttl, load)
+}
+
+// refreshed handles the outcome of a background refresh
+func (l *Loader) refreshed(ctx context.Context, key string, err error) {
+	if errors.Is(err, ErrKeyNotFound) {
+		// The source no longer has the key, so stop serving the old value
+		if l.config.NegativeTTL <= 0 {
+			l.cache.DeleteCtx(ctx, key)
+		}
+		return
+	}
+	if err != nil && l.config.OnRefreshError != nil {
+		l.config.OnRefreshError(key, err)
+	}
+}
+
+// load calls the LoadFunc and stores its result. Cache write failures are
+// ignored since the caller already has the value.
+func (l *Loader) load(ctx context.Context, key string, ttl time.Duration, load LoadFunc) (interface{}, error) {
+	value, err := load(ctx)
+	if errors.Is(err, ErrKeyNotFound) {
+		if l.config.NegativeTTL > 0 {
+			l.store(ctx, key, notFoundMarker, l.config.NegativeTTL)
+		}
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if l.wraps() {
+		l.store(ctx, key, newStaleEntry(value, ttl, l.config.Clock.Now()), hardTTL(ttl, l.config.StaleTTL))
+	} else {
+		l.store(ctx, key, value, ttl)
+	}
+	return value, nil
+}
+
+// wraps reports whether values are stored with the time they go stale
+func (l *Loader) wraps() bool {
+	return l.config.StaleTTL > 0 || l.config.RefreshAhead > 0
+}
+
+// store writes a loaded value, tagging it when the loader has tags
+func (l *Loader) store(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if len(l.config.Tags) > 0 {
+		return l.cache.SetWithTags(ctx, key, value, ttl, l.config.Tags)
+	}
+	return l.cache.SetCtx(ctx, key, value, ttl)
+}
+
+// staleEntry wraps a value stored by a loader with StaleTTL or RefreshAhead,
+// recording when it goes stale. Field names are fixed so the JSON backends round-trip it.
+type staleEntry struct {
+	Value      interface{} `json:"value"`
+	FreshUntil int64       `json:"fresh_until"` // unix milliseconds; zero never goes stale
+}
+
+// newStaleEntry wraps value to go stale ttl after now
+func newStaleEntry(value interface{}, ttl time.Duration, now time.Time) staleEntry {
+	entry := staleEntry{Value: value}
+	if ttl > 0 {
+		entry.FreshUntil = now.Add(ttl).UnixMilli()
+	}
+	return entry
+}
+
+// stale reports whether the entry should be refreshed at now
+func (e staleEntry) stale(now time.Time) bool {
+	return e.FreshUntil > 0 && now.UnixMilli() >= e.FreshUntil
+}
+
+// unwrapStale recovers a staleEntry from a cached value. The memory cache
+// returns the struct itself, the JSON backends a decoded map.
+func unwrapStale(value interface{}) (staleEntry, bool) {
+	switch v := value.(type) {
+	case staleEntry:
+		return v, true
+	case map[string]interface{}:
+		freshUntil, ok := v["fresh_until"].(float64)
+		if !ok {
+			return staleEntry{}, false
+		}
+		return staleEntry{Value: v["value"], FreshUntil: int64(freshUntil)}, true
+	}
+	return staleEntry{}, false
+}
+
+// hardTTL is how long a value with soft TTL ttl stays in the cache
+func hardTTL(ttl, staleTTL time.Duration) time.Duration {
+	if ttl <= 0 {
+		return 0
+	}
+	return ttl + staleTTL
+}
+
+// detachedContext keeps the values of its parent, such as trace IDs, but
+// not its deadline or cancellation
+type detachedContext struct {
+	parent context.Context
+}
+
+func (c detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (c detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (c detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestLoader returns a loader over a memory cache driven by clock
+func newTestLoader(t *testing.T, clock Clock, config LoaderConfig) *Loader {
+	t.Helper()
+	c, err := New(Config{Type: "memory", Clock: clock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return NewLoader(c, config)
+}
+
+// waitIdle waits until the loader has no load or refresh in flight
+func waitIdle(t *testing.T, l *Loader) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		l.mutex.Lock()
+		idle := len(l.calls) == 0
+		l.mutex.Unlock()
+		if idle {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("loader did not become idle")
+}
+
+// counter returns a LoadFunc yielding 1, 2, 3... and the number of calls
+func counter() (LoadFunc, *int64) {
+	var calls int64
+	return func(ctx context.Context) (interface{}, error) {
+		return atomic.AddInt64(&calls, 1), nil
+	}, &calls
+}
+
+func TestLoaderStaleWhileRevalidate(t *testing.T) {
+	clock := NewManualClock(time.Now())
+	l := newTestLoader(t, clock, LoaderConfig{StaleTTL: time.Minute})
+	load, calls := counter()
+
+	if value, _ := l.GetOrLoad("key", 10*time.Second, load); value != int64(1) {
+		t.Fatalf("first load = %v, want 1", value)
+	}
+
+	clock.Advance(5 * time.Second)
+	if value, _ := l.GetOrLoad("key", 10*time.Second, load); value != int64(1) || atomic.LoadInt64(calls) != 1 {
+		t.Fatalf("fresh read = %v after %d loads, want 1 after 1", value, atomic.LoadInt64(calls))
+	}
+
+	// Past the soft TTL the stale value is served while it refreshes
+	clock.Advance(10 * time.Second)
+	if value, _ := l.GetOrLoad("key", 10*time.Second, load); value != int64(1) {
+		t.Fatalf("stale read = %v, want 1", value)
+	}
+	waitIdle(t, l)
+	if value, _ := l.GetOrLoad("key", 10*time.Second, load); value != int64(2) {
+		t.Errorf("read after refresh = %v, want 2", value)
+	}
+}
+
+func TestLoaderRefreshAhead(t *testing.T) {
+	clock := NewManualClock(time.Now())
+	l := newTestLoader(t, clock, LoaderConfig{RefreshAhead: 2 * time.Second})
+	load, calls := counter()
+
+	l.GetOrLoad("key", 10*time.Second, load)
+
+	clock.Advance(7 * time.Second)
+	l.GetOrLoad("key", 10*time.Second, load)
+	waitIdle(t, l)
+	if n := atomic.LoadInt64(calls); n != 1 {
+		t.Fatalf("loads before the refresh window = %d, want 1", n)
+	}
+
+	// Within RefreshAhead of the TTL the value is reloaded before it expires
+	clock.Advance(2 * time.Second)
+	if value, _ := l.GetOrLoad("key", 10*time.Second, load); value != int64(1) {
+		t.Fatalf("read in the refresh window = %v, want 1", value)
+	}
+	waitIdle(t, l)
+
+	clock.Advance(2 * time.Second)
+	if value, _ := l.GetOrLoad("key", 10*time.Second, load); value != int64(2) {
+		t.Errorf("read past the original TTL = %v, want the refreshed 2", value)
+	}
+	if n := atomic.LoadInt64(calls); n != 2 {
+		t.Errorf("loads = %d, want 2", n)
+	}
+}
+
+func TestLoaderRefreshSharedWithMiss(t *testing.T) {
+	clock := NewManualClock(time.Now())
+	l := newTestLoader(t, clock, LoaderConfig{StaleTTL: time.Minute})
+
+	var calls int64
+	release := make(chan struct{})
+	load := func(ctx context.Context) (interface{}, error) {
+		if n := atomic.AddInt64(&calls, 1); n > 1 {
+			<-release
+		}
+		return "value", nil
+	}
+
+	l.GetOrLoad("key", time.Second, load)
+	clock.Advance(2 * time.Second)
+	l.GetOrLoad("key", time.Second, load) // starts a refresh that blocks
+
+	// A miss while the refresh runs joins it instead of loading again
+	l.cache.Delete("key")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if value, err := l.GetOrLoad("key", time.Second, load); value != "value" || err != nil {
+				t.Errorf("GetOrLoad = %v, %v, want value", value, err)
+			}
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt64(&calls); n != 2 {
+		t.Errorf("loads = %d, want 2", n)
+	}
+}
+
+func TestLoaderRefreshPanic(t *testing.T) {
+	clock := NewManualClock(time.Now())
+	var refreshErr atomic.Value
+	l := newTestLoader(t, clock, LoaderConfig{
+		StaleTTL:       time.Minute,
+		OnRefreshError: func(key string, err error) { refreshErr.Store(err) },
+	})
+
+	l.GetOrLoad("key", time.Second, func(ctx context.Context) (interface{}, error) { return "value", nil })
+	clock.Advance(2 * time.Second)
+	l.GetOrLoad("key", time.Second, func(ctx context.Context) (interface{}, error) { panic("boom") })
+	waitIdle(t, l)
+
+	if refreshErr.Load() == nil {
+		t.Error("OnRefreshError was not called for a panicking refresh")
+	}
+	value, _ := l.GetOrLoad("key", time.Second, func(ctx context.Context) (interface{}, error) { return "new", nil })
+	if value != "value" {
+		t.Errorf("read after failed refresh = %v, want the stale value", value)
+	}
+	waitIdle(t, l)
+}
@@ -0,0 +1,270 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Locker provides mutual exclusion across processes sharing a cache backend
+type Locker interface {
+	// Acquire takes the named lock for ttl, failing with ErrLockHeld if another owner holds it
+	// and with ErrInvalidTTL if ttl is not positive
+	Acquire(ctx context.Context, name string, ttl time.Duration) (*Lock, error)
+	// Release gives up the lock, failing with ErrLockNotHeld if it expired or was taken over
+	Release(ctx context.Context, lock *Lock) error
+	// Extend resets the lock's TTL, failing with ErrLockNotHeld if it expired or was taken over
+	Extend(ctx context.Context, lock *Lock, ttl time.Duration) error
+}
+
+// Lock is a held lock.
+//
+// Token is a fencing token that increases with every acquisition of the same
+// name. Pass it to the protected resource and reject writes carrying a lower
+// token than one already seen, so a holder whose lock expired mid-operation
+// cannot clobber the work of the next holder.
+type Lock struct {
+	Name  string
+	Token int64
+	owner string
+}
+
+// NewLocker returns a Locker backed by the same store as cache. Redis and
+// tiered caches lock in Redis; memory caches lock within the process, and
+// every call for the same cache returns the same locker so its users exclude
+// each other. Namespaced caches use the locker of the cache they wrap, so
+// lock names are not namespaced.
+func NewLocker(cache Cache) (Locker, error) {
+	switch c := cache.(type) {
+	case *RedisCache:
+		return NewRedisLocker(c.client), nil
+	case *TieredCache:
+		return NewLocker(c.far)
+	case *NamespacedCache:
+		return NewLocker(c.cache)
+	case *MemoryCache:
+		return c.locker.get(), nil
+	case *ShardedCache:
+		return c.locker.get(), nil
+	case *DiskCache:
+		return c.locker.get(), nil
+	}
+	return nil, fmt.Errorf("cache: no locker for %T", cache)
+}
+
+// sharedLocker lazily creates the MemoryLocker of an in-process cache
+type sharedLocker struct {
+	once   sync.Once
+	locker *MemoryLocker
+}
+
+// get returns the cache's locker, creating it on first use
+func (s *sharedLocker) get() *MemoryLocker {
+	s.once.Do(func() {
+		s.locker = NewMemoryLocker()
+	})
+	return s.locker
+}
+
+// lockKeys returns the Redis keys holding the lock owner and its fencing
+// counter. The hash tag keeps both in one cluster slot.
+func lockKeys(name string) []string {
+	return []string{"lock:{" + name + "}", "lock:{" + name + "}:fence"}
+}
+
+// acquireScript takes the lock and bumps the fencing counter atomically
+var acquireScript = redis.NewScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return redis.call('INCR', KEYS[2])
+end
+return 0
+`)
+
+// releaseScript deletes the lock only if it is still owned by the caller
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// extendScript resets the TTL only if the lock is still owned by the caller
+var extendScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// RedisLocker implements Locker with SET NX PX and Lua scripts
+type RedisLocker struct {
+	client redis.UniversalClient
+}
+
+// NewRedisLocker creates a Redis-backed locker
+func NewRedisLocker(client redis.UniversalClient) *RedisLocker {
+	return &RedisLocker{client: client}
+}
+
+// Acquire takes the named lock for ttl
+func (l *RedisLocker) Acquire(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	if ttl <= 0 {
+		return nil, ErrInvalidTTL
+	}
+
+	owner, err := newLockOwner()
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := acquireScript.Run(ctx, l.client, lockKeys(name), owner, ttlMillis(ttl)).Int64()
+	if err != nil {
+		return nil, err
+	}
+	if token == 0 {
+		return nil, ErrLockHeld
+	}
+
+	return &Lock{Name: name, Token: token, owner: owner}, nil
+}
+
+// Release gives up the lock if it is still held
+func (l *RedisLocker) Release(ctx context.Context, lock *Lock) error {
+	released, err := releaseScript.Run(ctx, l.client, lockKeys(lock.Name), lock.owner).Int()
+	if err != nil {
+		return err
+	}
+	if released == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Extend resets the lock's TTL if it is still held
+func (l *RedisLocker) Extend(ctx context.Context, lock *Lock, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+
+	extended, err := extendScript.Run(ctx, l.client, lockKeys(lock.Name), lock.owner, ttlMillis(ttl)).Int()
+	if err != nil {
+		return err
+	}
+	if extended == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// memoryLock is a lock held in a MemoryLocker
+type memoryLock struct {
+	owner      string
+	expiration time.Time
+}
+
+// MemoryLocker implements Locker within a single process
+type MemoryLocker struct {
+	locks  map[string]memoryLock
+	fences map[string]int64
+	mutex  sync.Mutex
+}
+
+// NewMemoryLocker creates an in-process locker
+func NewMemoryLocker() *MemoryLocker {
+	return &MemoryLocker{
+		locks:  make(map[string]memoryLock),
+		fences: make(map[string]int64),
+	}
+}
+
+// Acquire takes the named lock for ttl
+func (l *MemoryLocker) Acquire(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if ttl <= 0 {
+		return nil, ErrInvalidTTL
+	}
+
+	owner, err := newLockOwner()
+	if err != nil {
+		return nil, err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if _, held := l.held(name); held {
+		return nil, ErrLockHeld
+	}
+
+	l.fences[name]++
+	l.locks[name] = memoryLock{owner: owner, expiration: time.Now().Add(ttl)}
+
+	return &Lock{Name: name, Token: l.fences[name], owner: owner}, nil
+}
+
+// Release gives up the lock if it is still held
+func (l *MemoryLocker) Release(ctx context.Context, lock *Lock) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	current, held := l.held(lock.Name)
+	if !held || current.owner != lock.owner {
+		return ErrLockNotHeld
+	}
+	delete(l.locks, lock.Name)
+	return nil
+}
+
+// Extend resets the lock's TTL if it is still held
+func (l *MemoryLocker) Extend(ctx context.Context, lock *Lock, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	current, held := l.held(lock.Name)
+	if !held || current.owner != lock.owner {
+		return ErrLockNotHeld
+	}
+	current.expiration = time.Now().Add(ttl)
+	l.locks[lock.Name] = current
+	return nil
+}
+
+// held returns the live lock for name, dropping it if expired. Callers must hold the mutex.
+func (l *MemoryLocker) held(name string) (memoryLock, bool) {
+	lock, exists := l.locks[name]
+	if !exists {
+		return memoryLock{}, false
+	}
+	if !time.Now().Before(lock.expiration) {
+		delete(l.locks, name)
+		return memoryLock{}, false
+	}
+	return lock, true
+}
+
+// newLockOwner returns a random value identifying one acquisition of a lock
+func newLockOwner() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
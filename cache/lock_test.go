@@ -0,0 +1,296 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// lockerBackends returns a fresh locker of each kind, including one on a
+// real Redis server if REDIS_ADDR is set
+func lockerBackends(t *testing.T) map[string]Locker {
+	server := newRedisStandIn(t)
+	standIn := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { standIn.Close() })
+
+	lockers := map[string]Locker{
+		"memory": NewMemoryLocker(),
+		"redis":  NewRedisLocker(standIn),
+	}
+	if client := newRealRedisClient(t); client != nil {
+		lockers["redis-server"] = NewRedisLocker(client)
+	}
+	return lockers
+}
+
+// lockName returns a lock name unique to this run, deleting its keys from
+// a real Redis server when the test ends
+func lockName(t *testing.T) string {
+	name := fmt.Sprintf("locktest-%d", time.Now().UnixNano())
+	if client := newRealRedisClient(t); client != nil {
+		t.Cleanup(func() { client.Del(context.Background(), lockKeys(name)...) })
+	}
+	return name
+}
+
+func TestLockerAcquireRelease(t *testing.T) {
+	ctx := context.Background()
+	for backend, locker := range lockerBackends(t) {
+		t.Run(backend, func(t *testing.T) {
+			name := lockName(t)
+
+			first, err := locker.Acquire(ctx, name, time.Minute)
+			if err != nil {
+				t.Fatalf("Acquire: %v", err)
+			}
+			if _, err := locker.Acquire(ctx, name, time.Minute); err != ErrLockHeld {
+				t.Fatalf("second Acquire = %v, want ErrLockHeld", err)
+			}
+			if err := locker.Release(ctx, first); err != nil {
+				t.Fatalf("Release: %v", err)
+			}
+			if err := locker.Release(ctx, first); err != ErrLockNotHeld {
+				t.Fatalf("second Release = %v, want ErrLockNotHeld", err)
+			}
+
+			second, err := locker.Acquire(ctx, name, time.Minute)
+			if err != nil {
+				t.Fatalf("Acquire after Release: %v", err)
+			}
+			if second.Token <= first.Token {
+				t.Errorf("token %d after %d, want it to increase", second.Token, first.Token)
+			}
+			if err := locker.Extend(ctx, first, time.Minute); err != ErrLockNotHeld {
+				t.Errorf("Extend with a released lock = %v, want ErrLockNotHeld", err)
+			}
+		})
+	}
+}
+
+func TestLockerExpiry(t *testing.T) {
+	ctx := context.Background()
+	for backend, locker := range lockerBackends(t) {
+		t.Run(backend, func(t *testing.T) {
+			name := lockName(t)
+
+			expired, err := locker.Acquire(ctx, name, 50*time.Millisecond)
+			if err != nil {
+				t.Fatalf("Acquire: %v", err)
+			}
+			time.Sleep(100 * time.Millisecond)
+
+			current, err := locker.Acquire(ctx, name, time.Minute)
+			if err != nil {
+				t.Fatalf("Acquire after expiry: %v", err)
+			}
+			if current.Token <= expired.Token {
+				t.Errorf("token %d after %d, want it to increase", current.Token, expired.Token)
+			}
+
+			// The expired holder must not disturb the new one
+			if err := locker.Release(ctx, expired); err != ErrLockNotHeld {
+				t.Errorf("Release by the expired holder = %v, want ErrLockNotHeld", err)
+			}
+			if err := locker.Extend(ctx, expired, time.Minute); err != ErrLockNotHeld {
+				t.Errorf("Extend by the expired holder = %v, want ErrLockNotHeld", err)
+			}
+			if _, err := locker.Acquire(ctx, name, time.Minute); err != ErrLockHeld {
+				t.Errorf("Acquire while the new holder holds it = %v, want ErrLockHeld", err)
+			}
+		})
+	}
+}
+
+func TestLockerExtend(t *testing.T) {
+	ctx := context.Background()
+	for backend, locker := range lockerBackends(t) {
+		t.Run(backend, func(t *testing.T) {
+			name := lockName(t)
+
+			lock, err := locker.Acquire(ctx, name, 50*time.Millisecond)
+			if err != nil {
+				t.Fatalf("Acquire: %v", err)
+			}
+			if err := locker.Extend(ctx, lock, time.Minute); err != nil {
+				t.Fatalf("Extend: %v", err)
+			}
+			time.Sleep(100 * time.Millisecond)
+
+			if _, err := locker.Acquire(ctx, name, time.Minute); err != ErrLockHeld {
+				t.Errorf("Acquire after Extend = %v, want ErrLockHeld", err)
+			}
+			if err := locker.Release(ctx, lock); err != nil {
+				t.Errorf("Release after Extend: %v", err)
+			}
+		})
+	}
+}
+
+func TestLockerInvalidTTL(t *testing.T) {
+	ctx := context.Background()
+	for backend, locker := range lockerBackends(t) {
+		t.Run(backend, func(t *testing.T) {
+			name := lockName(t)
+
+			if _, err := locker.Acquire(ctx, name, 0); err != ErrInvalidTTL {
+				t.Errorf("Acquire with a zero TTL = %v, want ErrInvalidTTL", err)
+			}
+			lock, err := locker.Acquire(ctx, name, time.Minute)
+			if err != nil {
+				t.Fatalf("Acquire: %v", err)
+			}
+			if err := locker.Extend(ctx, lock, -time.Second); err != ErrInvalidTTL {
+				t.Errorf("Extend with a negative TTL = %v, want ErrInvalidTTL", err)
+			}
+		})
+	}
+}
+
+func TestLockerMutualExclusion(t *testing.T) {
+	ctx := context.Background()
+	for backend, locker := range lockerBackends(t) {
+		t.Run(backend, func(t *testing.T) {
+			name := lockName(t)
+
+			var inside int32
+			var mutex sync.Mutex
+			var tokens []int64
+
+			var wg sync.WaitGroup
+			for i := 0; i < atomicWorkers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for acquired := 0; acquired < 5; {
+						lock, err := locker.Acquire(ctx, name, time.Minute)
+						if err == ErrLockHeld {
+							time.Sleep(time.Millisecond)
+							continue
+						}
+						if err != nil {
+							t.Errorf("Acquire: %v", err)
+							return
+						}
+						acquired++
+
+						if n := atomic.AddInt32(&inside, 1); n != 1 {
+							t.Errorf("%d holders at once", n)
+						}
+						mutex.Lock()
+						tokens = append(tokens, lock.Token)
+						mutex.Unlock()
+						atomic.AddInt32(&inside, -1)
+
+						if err := locker.Release(ctx, lock); err != nil {
+							t.Errorf("Release: %v", err)
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			// Holders record their token while holding the lock, so tokens
+			// must appear in strictly increasing order
+			for i := 1; i < len(tokens); i++ {
+				if tokens[i] <= tokens[i-1] {
+					t.Fatalf("token %d followed %d", tokens[i], tokens[i-1])
+				}
+			}
+			if len(tokens) != atomicWorkers*5 {
+				t.Errorf("%d acquisitions, want %d", len(tokens), atomicWorkers*5)
+			}
+		})
+	}
+}
+
+// opaqueCache is a Cache that NewLocker does not know
+type opaqueCache struct {
+	Cache
+}
+
+func TestNewLocker(t *testing.T) {
+	ctx := context.Background()
+
+	memory, err := New(Config{Type: "memory"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { memory.Close() })
+
+	first, err := NewLocker(memory)
+	if err != nil {
+		t.Fatalf("NewLocker: %v", err)
+	}
+	second, _ := NewLocker(memory)
+	namespaced, _ := NewLocker(NewNamespaced(memory, "svc", 1))
+	if first != second || first != namespaced {
+		t.Fatal("NewLocker returned different lockers for the same memory cache")
+	}
+
+	// Lockers of one cache exclude each other
+	lock, err := first.Acquire(ctx, "job", time.Minute)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if _, err := second.Acquire(ctx, "job", time.Minute); err != ErrLockHeld {
+		t.Fatalf("Acquire through another NewLocker = %v, want ErrLockHeld", err)
+	}
+	first.Release(ctx, lock)
+
+	// Separate caches do not share locks
+	other, _ := New(Config{Type: "memory"})
+	t.Cleanup(func() { other.Close() })
+	otherLocker, _ := NewLocker(other)
+	if otherLocker == first {
+		t.Error("two memory caches share a locker")
+	}
+
+	sharded, _ := New(Config{Type: "sharded"})
+	t.Cleanup(func() { sharded.Close() })
+	disk := newTestDiskCache(t, filepath.Join(t.TempDir(), "cache.log"))
+	redisCache := newTestRedisCache(t)
+	tiered := NewTiered(newTestMemoryCache(t, Config{}), redisCache, time.Minute)
+
+	tests := []struct {
+		name  string
+		cache Cache
+		redis bool
+	}{
+		{"sharded", sharded, false},
+		{"disk", disk, false},
+		{"redis", redisCache, true},
+		{"tiered", tiered, true},
+		{"namespaced redis", NewNamespaced(redisCache, "svc", 1), true},
+	}
+	for _, tt := range tests {
+		locker, err := NewLocker(tt.cache)
+		if err != nil {
+			t.Errorf("%s: NewLocker: %v", tt.name, err)
+			continue
+		}
+		if _, isRedis := locker.(*RedisLocker); isRedis != tt.redis {
+			t.Errorf("%s: NewLocker returned %T", tt.name, locker)
+		}
+	}
+
+	// A lock taken through the tiered cache is visible through its far cache
+	viaTiered, _ := NewLocker(tiered)
+	viaRedis, _ := NewLocker(redisCache)
+	if _, err := viaTiered.Acquire(ctx, "job", time.Minute); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if _, err := viaRedis.Acquire(ctx, "job", time.Minute); err != ErrLockHeld {
+		t.Errorf("Acquire through the far cache = %v, want ErrLockHeld", err)
+	}
+
+	if _, err := NewLocker(opaqueCache{memory}); err == nil {
+		t.Error("NewLocker accepted an unknown cache")
+	}
+}
@@ -1,83 +1,201 @@
 package cache
 
 import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // item represents a cached item with expiration
 type item struct {
 	value      interface{}
-	expiration int64 // unix timestamp
+	expiration int64 // unix time in nanoseconds, zero if the item never expires
+	size       int64 // estimated size in bytes, used for MaxBytes accounting
+	tags       []string
 }
 
+// expired reports whether the item's TTL has passed at now (unix nanoseconds)
+func (i *item) expired(now int64) bool {
+	return i.expiration > 0 && now >= i.expiration
+}
+
+// defaultCleanupInterval is used when Config.CleanupInterval is not set
+const defaultCleanupInterval = 5 * time.Minute
+
 // MemoryCache implements in-memory caching
 type MemoryCache struct {
 	items map[string]*item
+	tags  map[string]map[string]struct{} // tag -> keys
 	mutex sync.RWMutex
+
+	maxEntries int
+	maxBytes   int64
+	usedBytes  int64
+	policy     evictionPolicy
+	stats      recorder
+	clock      Clock
+
+	onEvict  []RemovalFunc
+	onExpire []RemovalFunc
+	pending  []RemovalEvent // removals to report once the write lock is released
+
+	locker sharedLocker // returned by NewLocker
+
+	stop      chan struct{}
+	closeOnce sync.Once
 }
 
 // newMemoryCache creates a new in-memory cache
-func newMemoryCache() *MemoryCache {
+func newMemoryCache(config Config) *MemoryCache {
 	cache := &MemoryCache{
-		items: make(map[string]*item),
+		items:      make(map[string]*item),
+		tags:       make(map[string]map[string]struct{}),
+		maxEntries: config.MaxEntries,
+		maxBytes:   config.MaxBytes,
+		policy:     newEvictionPolicy(config.EvictionPolicy),
+		stats:      recorder{observer: config.Observer},
+		clock:      config.Clock,
+		stop:       make(chan struct{}),
+	}
+	if cache.clock == nil {
+		cache.clock = systemClock{}
+	}
+
+	interval := config.CleanupInterval
+	if interval == 0 {
+		interval = defaultCleanupInterval
 	}
 
 	// Start cleanup goroutine
-	go cache.cleanup()
+	if interval > 0 {
+		go cache.cleanup(interval)
+	}
 
 	return cache
 }
 
 // Set stores a value in the cache with TTL
 func (c *MemoryCache) Set(key string, value interface{}, ttl time.Duration) error {
+	return c.SetCtx(context.Background(), key, value, ttl)
+}
+
+// SetCtx stores a value in the cache with TTL unless ctx is already done
+func (c *MemoryCache) SetCtx(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	start := time.Now()
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
+	c.set(key, value, ttl, nil)
+	c.unlock()
 
-	var expiration int64
-	if ttl > 0 {
-		expiration = time.Now().Add(ttl).Unix()
+	c.stats.write(OpSet, key, nil, start)
+	return nil
+}
+
+// SetWithTags stores a value with TTL and indexes it under tags
+func (c *MemoryCache) SetWithTags(ctx context.Context, key string, value interface{}, ttl time.Duration, tags []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	c.items[key] = &item{
-		value:      value,
-		expiration: expiration,
+	start := time.Now()
+	c.mutex.Lock()
+	c.set(key, value, ttl, tags)
+	c.unlock()
+
+	c.stats.write(OpSet, key, nil, start)
+	return nil
+}
+
+// InvalidateTag removes every key stored with the tag
+func (c *MemoryCache) InvalidateTag(ctx context.Context, tag string) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
+	c.mutex.Lock()
+	defer c.unlock()
+
+	for key := range c.tags[tag] {
+		c.remove(key)
+	}
+	return nil
+}
+
+// DeletePrefix removes every key starting with prefix
+func (c *MemoryCache) DeletePrefix(ctx context.Context, prefix string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.unlock()
+
+	for key := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			c.remove(key)
+		}
+	}
 	return nil
 }
 
 // Get retrieves a value from the cache
 func (c *MemoryCache) Get(key string) (interface{}, error) {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
+	return c.GetCtx(context.Background(), key)
+}
 
-	item, exists := c.items[key]
-	if !exists {
-		return nil, ErrKeyNotFound
+// GetCtx retrieves a value from the cache unless ctx is already done
+func (c *MemoryCache) GetCtx(ctx context.Context, key string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	// Check if expired
-	if item.expiration > 0 && time.Now().Unix() > item.expiration {
-		// Item expired, delete it
-		delete(c.items, key)
-		return nil, ErrKeyNotFound
-	}
+	start := time.Now()
+	c.mutex.Lock()
+	value, err := c.get(key)
+	c.unlock()
 
-	return item.value, nil
+	c.stats.lookup(OpGet, key, err, start)
+	return value, err
 }
 
 // Delete removes a key from the cache
 func (c *MemoryCache) Delete(key string) error {
+	return c.DeleteCtx(context.Background(), key)
+}
+
+// DeleteCtx removes a key from the cache unless ctx is already done
+func (c *MemoryCache) DeleteCtx(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	start := time.Now()
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
+	c.remove(key)
+	c.unlock()
 
-	delete(c.items, key)
+	c.stats.remove(OpDelete, key, nil, start)
 	return nil
 }
 
 // Exists checks if a key exists in the cache
 func (c *MemoryCache) Exists(key string) bool {
+	return c.ExistsCtx(context.Background(), key)
+}
+
+// ExistsCtx checks if a key exists in the cache; it reports false if ctx is already done
+func (c *MemoryCache) ExistsCtx(ctx context.Context, key string) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 
@@ -87,31 +205,522 @@ func (c *MemoryCache) Exists(key string) bool {
 	}
 
 	// Check if expired
-	if item.expiration > 0 && time.Now().Unix() > item.expiration {
+	if item.expired(c.now()) {
 		return false
 	}
 
 	return true
 }
 
-// Close is a no-op for memory cache
+// MGet looks up several keys under a single lock
+func (c *MemoryCache) MGet(ctx context.Context, keys []string) ([]Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	c.mutex.Lock()
+	results := make([]Result, len(keys))
+	for i, key := range keys {
+		value, err := c.get(key)
+		results[i] = Result{Key: key, Value: value, Err: err}
+	}
+	c.unlock()
+
+	for _, result := range results {
+		c.stats.lookup(OpMGet, result.Key, result.Err, start)
+	}
+	return results, nil
+}
+
+// MSet stores several entries under a single lock
+func (c *MemoryCache) MSet(ctx context.Context, entries []Entry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	c.mutex.Lock()
+	for _, entry := range entries {
+		c.set(entry.Key, entry.Value, entry.TTL, nil)
+	}
+	c.unlock()
+
+	for _, entry := range entries {
+		c.stats.write(OpMSet, entry.Key, nil, start)
+	}
+	return nil
+}
+
+// MDelete removes several keys under a single lock
+func (c *MemoryCache) MDelete(ctx context.Context, keys []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	c.mutex.Lock()
+	for _, key := range keys {
+		c.remove(key)
+	}
+	c.unlock()
+
+	for _, key := range keys {
+		c.stats.remove(OpMDelete, key, nil, start)
+	}
+	return nil
+}
+
+// Incr atomically adds delta to an integer counter, creating it if missing
+func (c *MemoryCache) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	c.mutex.Lock()
+	defer c.unlock()
+
+	value, err := c.get(key)
+	if err == ErrKeyNotFound {
+		c.set(key, delta, ttl, nil)
+		return delta, nil
+	}
+
+	current, ok := toInt64(value)
+	if !ok {
+		return 0, ErrNotInteger
+	}
+
+	// Keep the existing expiry and tags, and only start a window if there is none
+	item := c.items[key]
+	current += delta
+	item.value = current
+	if item.expiration == 0 && ttl > 0 {
+		item.expiration = c.now() + int64(ttl)
+	}
+	return current, nil
+}
+
+// Decr atomically subtracts delta from an integer counter, creating it if missing
+func (c *MemoryCache) Decr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	return c.Incr(ctx, key, -delta, ttl)
+}
+
+// SetNX stores a value only if the key does not exist
+func (c *MemoryCache) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	c.mutex.Lock()
+	defer c.unlock()
+
+	if _, err := c.get(key); err == nil {
+		return false, nil
+	}
+
+	c.set(key, value, ttl, nil)
+	return true, nil
+}
+
+// CompareAndSwap replaces the value only if the current value has the same
+// JSON encoding as old, matching the Redis implementation. The key keeps its tags.
+func (c *MemoryCache) CompareAndSwap(ctx context.Context, key string, old, new interface{}, ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	expected, err := json.Marshal(old)
+	if err != nil {
+		return false, err
+	}
+
+	c.mutex.Lock()
+	defer c.unlock()
+
+	value, err := c.get(key)
+	if err != nil {
+		return false, nil
+	}
+
+	current, err := json.Marshal(value)
+	if err != nil || !sameJSON(current, expected) {
+		return false, nil
+	}
+
+	c.set(key, new, ttl, c.items[key].tags)
+	return true, nil
+}
+
+// Keys returns the live keys matching pattern, sorted
+func (c *MemoryCache) Keys(ctx context.Context, pattern string) ([]string, error) {
+	return collectKeys(ctx, c.Scan, pattern)
+}
+
+// Scan calls fn for each live key matching pattern, in sorted order. The
+// keys are gathered under the lock first, so fn may call back into the cache.
+func (c *MemoryCache) Scan(ctx context.Context, pattern string, fn func(key string) bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if pattern == "" {
+		pattern = "*"
+	}
+
+	c.mutex.RLock()
+	now := c.now()
+	var keys []string
+	for key, item := range c.items {
+		if !item.expired(now) && matchPattern(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	c.mutex.RUnlock()
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !fn(key) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// TTL returns the remaining lifetime of key, zero if it never expires
+func (c *MemoryCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	item, exists := c.items[key]
+	now := c.now()
+	if !exists || item.expired(now) {
+		return 0, ErrKeyNotFound
+	}
+	if item.expiration == 0 {
+		return 0, nil
+	}
+	return time.Duration(item.expiration - now), nil
+}
+
+// Peek returns the value and remaining lifetime of key, leaving stats and
+// eviction order untouched
+func (c *MemoryCache) Peek(ctx context.Context, key string) (interface{}, time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	item, exists := c.items[key]
+	now := c.now()
+	if !exists || item.expired(now) {
+		return nil, 0, ErrKeyNotFound
+	}
+	if item.expiration == 0 {
+		return item.value, 0, nil
+	}
+	return item.value, time.Duration(item.expiration - now), nil
+}
+
+// Expire sets the TTL of an existing key, or removes its expiry if ttl is not positive
+func (c *MemoryCache) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.unlock()
+
+	if _, err := c.get(key); err != nil {
+		return err
+	}
+
+	item := c.items[key]
+	item.expiration = 0
+	if ttl > 0 {
+		item.expiration = c.now() + int64(ttl)
+	}
+	return nil
+}
+
+// Close stops the cleanup goroutine. The cache remains usable, but expired
+// items are then only dropped when read or by DeleteExpired.
 func (c *MemoryCache) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.stop)
+	})
 	return nil
 }
 
-// cleanup runs in a goroutine to remove expired items
-func (c *MemoryCache) cleanup() {
-	ticker := time.NewTicker(5 * time.Minute)
+// DeleteExpired removes every expired item, as the cleanup goroutine does on each tick
+func (c *MemoryCache) DeleteExpired() {
+	c.mutex.Lock()
+	defer c.unlock()
+
+	now := c.now()
+	for key, item := range c.items {
+		if item.expired(now) {
+			c.removed(key, item.value, RemovalExpired)
+			c.remove(key)
+			c.stats.expired(key)
+		}
+	}
+}
+
+// OnEvict registers fn to be called with the key and value of every entry
+// evicted to respect the size limits
+func (c *MemoryCache) OnEvict(fn RemovalFunc) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.onEvict = append(c.onEvict, fn)
+	return nil
+}
+
+// OnExpire registers fn to be called with the key and value of every expired
+// entry. Expiry is noticed when the entry is read or swept by the cleanup
+// goroutine, so fn may run up to CleanupInterval after the TTL passed.
+func (c *MemoryCache) OnExpire(fn RemovalFunc) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.onExpire = append(c.onExpire, fn)
+	return nil
+}
+
+// Evictions returns the number of entries evicted to respect the size limits
+func (c *MemoryCache) Evictions() uint64 {
+	return atomic.LoadUint64(&c.stats.evictions)
+}
+
+// Stats returns the cache counters along with the current item count and size
+func (c *MemoryCache) Stats(ctx context.Context) (Stats, error) {
+	if err := ctx.Err(); err != nil {
+		return Stats{}, err
+	}
+
+	stats := c.stats.snapshot()
+
+	c.mutex.RLock()
+	stats.Items = int64(len(c.items))
+	stats.Bytes = c.usedBytes
+	c.mutex.RUnlock()
+
+	return stats, nil
+}
+
+// get returns a live value, dropping it if expired. Callers must hold the write lock.
+func (c *MemoryCache) get(key string) (interface{}, error) {
+	item, exists := c.items[key]
+	if !exists {
+		return nil, ErrKeyNotFound
+	}
+
+	// Check if expired
+	if item.expired(c.now()) {
+		// Item expired, delete it
+		c.removed(key, item.value, RemovalExpired)
+		c.remove(key)
+		c.stats.expired(key)
+		return nil, ErrKeyNotFound
+	}
+
+	c.policy.access(key)
+
+	return item.value, nil
+}
+
+// set stores a value and updates the bookkeeping. Callers must hold the write lock.
+func (c *MemoryCache) set(key string, value interface{}, ttl time.Duration, tags []string) {
+	var expiration int64
+	if ttl > 0 {
+		expiration = c.now() + int64(ttl)
+	}
+
+	// Release the size and tags of any previous entry
+	if old, exists := c.items[key]; exists {
+		c.usedBytes -= old.size
+		c.untag(key, old.tags)
+	}
+
+	size := int64(len(key)) + estimateSize(value)
+	c.items[key] = &item{
+		value:      value,
+		expiration: expiration,
+		size:       size,
+		tags:       tags,
+	}
+	c.usedBytes += size
+	c.policy.add(key)
+
+	for _, tag := range tags {
+		keys, ok := c.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			c.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+
+	c.evict()
+}
+
+// remove deletes a key and its bookkeeping. Callers must hold the write lock.
+func (c *MemoryCache) remove(key string) {
+	item, exists := c.items[key]
+	if !exists {
+		return
+	}
+	c.usedBytes -= item.size
+	delete(c.items, key)
+	c.policy.remove(key)
+	c.untag(key, item.tags)
+}
+
+// untag removes key from the index of each tag. Callers must hold the write lock.
+func (c *MemoryCache) untag(key string, tags []string) {
+	for _, tag := range tags {
+		keys := c.tags[tag]
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+}
+
+// evict removes entries chosen by the eviction policy until the cache is
+// within MaxEntries and MaxBytes. Callers must hold the write lock.
+func (c *MemoryCache) evict() {
+	for c.overLimit() {
+		key, ok := c.policy.victim()
+		if !ok {
+			return
+		}
+		c.removed(key, c.items[key].value, RemovalEvicted)
+		c.remove(key)
+		c.stats.evicted(key)
+	}
+}
+
+// overLimit reports whether the cache exceeds its configured limits
+func (c *MemoryCache) overLimit() bool {
+	if c.maxEntries > 0 && len(c.items) > c.maxEntries {
+		return true
+	}
+	return c.maxBytes > 0 && c.usedBytes > c.maxBytes
+}
+
+// removed queues a removal event for the listeners. Callers must hold the write lock.
+func (c *MemoryCache) removed(key string, value interface{}, reason RemovalReason) {
+	if len(c.onEvict) == 0 && len(c.onExpire) == 0 {
+		return
+	}
+	c.pending = append(c.pending, RemovalEvent{Key: key, Value: value, Reason: reason})
+}
+
+// unlock releases the write lock and then delivers the queued removal
+// events, so listeners are free to call back into the cache
+func (c *MemoryCache) unlock() {
+	pending := c.pending
+	c.pending = nil
+	onEvict, onExpire := c.onEvict, c.onExpire
+	c.mutex.Unlock()
+
+	for _, event := range pending {
+		listeners := onExpire
+		if event.Reason == RemovalEvicted {
+			listeners = onEvict
+		}
+		for _, fn := range listeners {
+			fn(event)
+		}
+	}
+}
+
+// now returns the current time in unix nanoseconds
+func (c *MemoryCache) now() int64 {
+	return c.clock.Now().UnixNano()
+}
+
+// timeSource returns the Clock the cache keeps time with
+func (c *MemoryCache) timeSource() Clock {
+	return c.clock
+}
+
+// cleanup runs in a goroutine to remove expired items until Close
+func (c *MemoryCache) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		c.mutex.Lock()
-		now := time.Now().Unix()
-		for key, item := range c.items {
-			if item.expiration > 0 && now > item.expiration {
-				delete(c.items, key)
-			}
+	for {
+		select {
+		case <-ticker.C:
+			c.DeleteExpired()
+		case <-c.stop:
+			return
 		}
-		c.mutex.Unlock()
 	}
-}
\ No newline at end of file
+}
+
+// estimateSize approximates the memory footprint of a cached value.
+// Strings and byte slices are measured exactly; other values are
+// measured by their JSON encoding.
+func estimateSize(value interface{}) int64 {
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case []byte:
+		return int64(len(v))
+	case string:
+		return int64(len(v))
+	case bool, int8, uint8:
+		return 1
+	case int16, uint16:
+		return 2
+	case int32, uint32, float32:
+		return 4
+	case int, uint, int64, uint64, float64, time.Duration:
+		return 8
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return 0
+	}
+	return int64(len(data))
+}
+
+// toInt64 converts integer values stored by Set or Incr to int64
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), true
+	}
+	return 0, false
+}
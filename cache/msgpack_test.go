@@ -0,0 +1,193 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// msgpackCase is a value with the format code it must encode to
+type msgpackCase struct {
+	name  string
+	value interface{}
+	code  byte
+}
+
+// msgpackCases covers every size class the encoder produces
+func msgpackCases() []msgpackCase {
+	ints := func(n int) []int { return make([]int, n) }
+	object := func(n int) map[string]int {
+		m := make(map[string]int, n)
+		for i := 0; i < n; i++ {
+			m["key"+strconv.Itoa(i)] = i
+		}
+		return m
+	}
+
+	return []msgpackCase{
+		{"nil", (*int)(nil), 0xc0},
+		{"false", false, 0xc2},
+		{"true", true, 0xc3},
+		{"positive fixint", 127, 0x7f},
+		{"negative fixint", -32, 0xe0},
+		{"uint8", 255, 0xcc},
+		{"uint16", 65535, 0xcd},
+		{"uint32", uint32(math.MaxUint32), 0xce},
+		{"uint64", uint64(1) << 40, 0xcf},
+		{"uint64 above MaxInt64", uint64(math.MaxUint64), 0xcf},
+		{"int8", int8(math.MinInt8), 0xd0},
+		{"int16", int16(math.MinInt16), 0xd1},
+		{"int32", int32(math.MinInt32), 0xd2},
+		{"int64", int64(math.MinInt64), 0xd3},
+		{"float64", 1.5, 0xcb},
+		{"fixstr", strings.Repeat("s", 31), 0xbf},
+		{"str8", strings.Repeat("s", 255), 0xd9},
+		{"str16", strings.Repeat("s", 65535), 0xda},
+		{"str32", strings.Repeat("s", 65536), 0xdb},
+		{"fixarray", ints(15), 0x9f},
+		{"array16", ints(16), 0xdc},
+		{"array32", ints(65536), 0xdd},
+		{"fixmap", object(15), 0x8f},
+		{"map16", object(16), 0xde},
+		{"map32", object(65536), 0xdf},
+	}
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	for _, tc := range msgpackCases() {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := MsgpackCodec.Marshal(tc.value)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if data[0] != tc.code {
+				t.Errorf("format = 0x%02x, want 0x%02x", data[0], tc.code)
+			}
+
+			decoded := reflect.New(reflect.TypeOf(tc.value))
+			if err := MsgpackCodec.Unmarshal(data, decoded.Interface()); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if got := decoded.Elem().Interface(); !reflect.DeepEqual(got, tc.value) {
+				t.Errorf("round trip changed the value (%T)", got)
+			}
+		})
+	}
+}
+
+func TestMsgpackStruct(t *testing.T) {
+	type profile struct {
+		Name   string            `json:"name"`
+		Email  string            `json:"email,omitempty"`
+		Tags   []string          `json:"tags"`
+		Score  float64           `json:"score"`
+		Avatar []byte            `json:"avatar"`
+		Meta   map[string]string `json:"meta"`
+	}
+	in := profile{Name: "ann", Tags: []string{"a", "b"}, Score: -2.25, Avatar: []byte{0, 1, 255}, Meta: map[string]string{"z": "1", "a": "2"}}
+
+	first, err := MsgpackCodec.Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	second, _ := MsgpackCodec.Marshal(in)
+	if !bytes.Equal(first, second) {
+		t.Error("equal values encoded differently")
+	}
+
+	var out profile
+	if err := MsgpackCodec.Unmarshal(first, &out); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("Unmarshal = %+v, want %+v", out, in)
+	}
+}
+
+func TestMsgpackDecodeForeignFormats(t *testing.T) {
+	// Formats other encoders produce but MsgpackCodec never writes
+	tests := []struct {
+		name string
+		data []byte
+		into interface{}
+		want interface{}
+	}{
+		{"float32", []byte{0xca, 0x3f, 0xc0, 0x00, 0x00}, new(float64), 1.5},
+		{"bin8", []byte{0xc4, 0x02, 'h', 'i'}, new([]byte), []byte("hi")},
+		{"bin16", []byte{0xc5, 0x00, 0x02, 'h', 'i'}, new([]byte), []byte("hi")},
+		{"bin32", []byte{0xc6, 0x00, 0x00, 0x00, 0x02, 'h', 'i'}, new([]byte), []byte("hi")},
+		{"positive int8", []byte{0xd0, 0x05}, new(int), 5},
+		{"wide uint", []byte{0xcd, 0x00, 0x01}, new(int), 1},
+		{"integer map key", []byte{0x81, 0x01, 0xa1, 'x'}, new(map[string]string), map[string]string{"1": "x"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := MsgpackCodec.Unmarshal(tt.data, tt.into); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if got := reflect.ValueOf(tt.into).Elem().Interface(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unmarshal = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMsgpackTruncated(t *testing.T) {
+	for _, tc := range msgpackCases() {
+		data, err := MsgpackCodec.Marshal(tc.value)
+		if err != nil {
+			t.Fatalf("%s: Marshal: %v", tc.name, err)
+		}
+		// Every proper prefix must fail cleanly; long values are sampled
+		step := 1 + len(data)/64
+		for n := 0; n < len(data); n += step {
+			var v interface{}
+			if err := MsgpackCodec.Unmarshal(data[:n], &v); !errors.Is(err, errMsgpackTruncated) {
+				t.Errorf("%s: Unmarshal of %d/%d bytes = %v, want errMsgpackTruncated", tc.name, n, len(data), err)
+				break
+			}
+		}
+	}
+
+	// Lengths far beyond the input must not allocate for them
+	for _, data := range [][]byte{
+		{0xdb, 0xff, 0xff, 0xff, 0xff},
+		{0xc6, 0xff, 0xff, 0xff, 0xff},
+		{0xdd, 0xff, 0xff, 0xff, 0xff},
+		{0xdf, 0xff, 0xff, 0xff, 0xff},
+	} {
+		var v interface{}
+		if err := MsgpackCodec.Unmarshal(data, &v); !errors.Is(err, errMsgpackTruncated) {
+			t.Errorf("Unmarshal(% x) = %v, want errMsgpackTruncated", data, err)
+		}
+	}
+}
+
+func TestMsgpackInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"trailing data", []byte{0x01, 0xc0}, "trailing data"},
+		{"unsupported format", []byte{0xc1}, "unsupported format"},
+		{"extension", []byte{0xd4, 0x01, 0x00}, "unsupported format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v interface{}
+			err := MsgpackCodec.Unmarshal(tt.data, &v)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Unmarshal = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := MsgpackCodec.Marshal(make(chan int)); err == nil {
+		t.Error("Marshal of a channel succeeded")
+	}
+}
@@ -0,0 +1,236 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NamespacedCache prefixes every key and tag with a namespace and schema
+// version, so several services can share one cache and a service can drop
+// all of its entries logically by bumping the version. Entries written under
+// an older version are no longer visible and expire on their own TTL.
+type NamespacedCache struct {
+	cache  Cache
+	prefix string
+}
+
+// NewNamespaced wraps cache so every key is stored as "namespace:vN:key".
+// An empty namespace is left out, and so is a zero version.
+func NewNamespaced(cache Cache, namespace string, version int) *NamespacedCache {
+	var parts []string
+	if namespace != "" {
+		parts = append(parts, namespace)
+	}
+	if version != 0 {
+		parts = append(parts, "v"+strconv.Itoa(version))
+	}
+
+	prefix := strings.Join(parts, ":")
+	if prefix != "" {
+		prefix += ":"
+	}
+
+	return &NamespacedCache{
+		cache:  cache,
+		prefix: prefix,
+	}
+}
+
+// key returns the stored form of key
+func (c *NamespacedCache) key(key string) string {
+	return c.prefix + key
+}
+
+// keys returns the stored form of each of keys
+func (c *NamespacedCache) keys(keys []string) []string {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = c.key(key)
+	}
+	return prefixed
+}
+
+// Set stores a value with TTL
+func (c *NamespacedCache) Set(key string, value interface{}, ttl time.Duration) error {
+	return c.cache.Set(c.key(key), value, ttl)
+}
+
+// Get retrieves a value
+func (c *NamespacedCache) Get(key string) (interface{}, error) {
+	return c.cache.Get(c.key(key))
+}
+
+// Delete removes a key
+func (c *NamespacedCache) Delete(key string) error {
+	return c.cache.Delete(c.key(key))
+}
+
+// Exists checks if a key exists
+func (c *NamespacedCache) Exists(key string) bool {
+	return c.cache.Exists(c.key(key))
+}
+
+// SetCtx stores a value with TTL
+func (c *NamespacedCache) SetCtx(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return c.cache.SetCtx(ctx, c.key(key), value, ttl)
+}
+
+// GetCtx retrieves a value
+func (c *NamespacedCache) GetCtx(ctx context.Context, key string) (interface{}, error) {
+	return c.cache.GetCtx(ctx, c.key(key))
+}
+
+// DeleteCtx removes a key
+func (c *NamespacedCache) DeleteCtx(ctx context.Context, key string) error {
+	return c.cache.DeleteCtx(ctx, c.key(key))
+}
+
+// ExistsCtx checks if a key exists
+func (c *NamespacedCache) ExistsCtx(ctx context.Context, key string) bool {
+	return c.cache.ExistsCtx(ctx, c.key(key))
+}
+
+// SetWithTags stores a value with TTL under namespaced tags
+func (c *NamespacedCache) SetWithTags(ctx context.Context, key string, value interface{}, ttl time.Duration, tags []string) error {
+	return c.cache.SetWithTags(ctx, c.key(key), value, ttl, c.keys(tags))
+}
+
+// InvalidateTag removes every key stored with the tag in this namespace
+func (c *NamespacedCache) InvalidateTag(ctx context.Context, tag string) error {
+	return c.cache.InvalidateTag(ctx, c.key(tag))
+}
+
+// DeletePrefix removes every key in this namespace starting with prefix
+func (c *NamespacedCache) DeletePrefix(ctx context.Context, prefix string) error {
+	return c.cache.DeletePrefix(ctx, c.key(prefix))
+}
+
+// MGet looks up several keys at once, reporting results under the caller's keys
+func (c *NamespacedCache) MGet(ctx context.Context, keys []string) ([]Result, error) {
+	results, err := c.cache.MGet(ctx, c.keys(keys))
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].Key = keys[i]
+	}
+	return results, nil
+}
+
+// MSet stores several entries at once
+func (c *NamespacedCache) MSet(ctx context.Context, entries []Entry) error {
+	prefixed := make([]Entry, len(entries))
+	for i, entry := range entries {
+		prefixed[i] = Entry{Key: c.key(entry.Key), Value: entry.Value, TTL: entry.TTL}
+	}
+	return c.cache.MSet(ctx, prefixed)
+}
+
+// MDelete removes several keys at once
+func (c *NamespacedCache) MDelete(ctx context.Context, keys []string) error {
+	return c.cache.MDelete(ctx, c.keys(keys))
+}
+
+// Incr atomically adds delta to an integer counter, creating it if missing
+func (c *NamespacedCache) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	return c.cache.Incr(ctx, c.key(key), delta, ttl)
+}
+
+// Decr atomically subtracts delta from an integer counter, creating it if missing
+func (c *NamespacedCache) Decr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	return c.cache.Decr(ctx, c.key(key), delta, ttl)
+}
+
+// SetNX stores a value only if the key does not exist
+func (c *NamespacedCache) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	return c.cache.SetNX(ctx, c.key(key), value, ttl)
+}
+
+// CompareAndSwap replaces the value only if the current value equals old
+func (c *NamespacedCache) CompareAndSwap(ctx context.Context, key string, old, new interface{}, ttl time.Duration) (bool, error) {
+	return c.cache.CompareAndSwap(ctx, c.key(key), old, new, ttl)
+}
+
+// Keys returns the keys in this namespace matching pattern, without the prefix
+func (c *NamespacedCache) Keys(ctx context.Context, pattern string) ([]string, error) {
+	return collectKeys(ctx, c.Scan, pattern)
+}
+
+// Scan calls fn for each key in this namespace matching pattern, without the prefix
+func (c *NamespacedCache) Scan(ctx context.Context, pattern string, fn func(key string) bool) error {
+	if pattern == "" {
+		pattern = "*"
+	}
+	return c.cache.Scan(ctx, escapePattern(c.prefix)+pattern, func(key string) bool {
+		return fn(strings.TrimPrefix(key, c.prefix))
+	})
+}
+
+// TTL returns the remaining lifetime of key
+func (c *NamespacedCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return c.cache.TTL(ctx, c.key(key))
+}
+
+// Peek returns the value and remaining lifetime of key
+func (c *NamespacedCache) Peek(ctx context.Context, key string) (interface{}, time.Duration, error) {
+	return c.cache.Peek(ctx, c.key(key))
+}
+
+// Expire sets the TTL of an existing key
+func (c *NamespacedCache) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	return c.cache.Expire(ctx, c.key(key), ttl)
+}
+
+// Stats returns the stats of the underlying cache, which cover every namespace
+func (c *NamespacedCache) Stats(ctx context.Context) (Stats, error) {
+	return c.cache.Stats(ctx)
+}
+
+// OnEvict registers fn for evictions of keys in this namespace, if the
+// underlying cache reports them. Keys are passed without the prefix.
+func (c *NamespacedCache) OnEvict(fn RemovalFunc) error {
+	notifier, ok := c.cache.(RemovalNotifier)
+	if !ok {
+		return fmt.Errorf("cache: %T does not report removals", c.cache)
+	}
+	return notifier.OnEvict(c.scoped(fn))
+}
+
+// OnExpire registers fn for expiry of keys in this namespace, if the
+// underlying cache reports it. Keys are passed without the prefix.
+func (c *NamespacedCache) OnExpire(fn RemovalFunc) error {
+	notifier, ok := c.cache.(RemovalNotifier)
+	if !ok {
+		return fmt.Errorf("cache: %T does not report removals", c.cache)
+	}
+	return notifier.OnExpire(c.scoped(fn))
+}
+
+// scoped wraps fn to only see removals of keys in this namespace
+func (c *NamespacedCache) scoped(fn RemovalFunc) RemovalFunc {
+	return func(event RemovalEvent) {
+		if !strings.HasPrefix(event.Key, c.prefix) {
+			return
+		}
+		event.Key = strings.TrimPrefix(event.Key, c.prefix)
+		fn(event)
+	}
+}
+
+// Close closes the underlying cache
+func (c *NamespacedCache) Close() error {
+	return c.cache.Close()
+}
+
+// Prefix returns the prefix added to every key, e.g. "users:v2:"
+func (c *NamespacedCache) Prefix() string {
+	return c.prefix
+}
+
+// Cache returns the underlying cache
+func (c *NamespacedCache) Cache() Cache {
+	return c.cache
+}
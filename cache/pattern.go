@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"context"
+	"sort"
+)
+
+// matchPattern reports whether key matches a Redis-style glob pattern:
+// * matches any sequence, ? any single byte, [abc] or [a-z] one byte of a
+// class ([^...] negates it), and \ escapes the next character
+func matchPattern(pattern, key string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(key); i++ {
+				if matchPattern(pattern, key[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(key) == 0 {
+				return false
+			}
+			pattern, key = pattern[1:], key[1:]
+		case '[':
+			if len(key) == 0 {
+				return false
+			}
+			matched, rest, ok := matchClass(pattern[1:], key[0])
+			if !ok || !matched {
+				return false
+			}
+			pattern, key = rest, key[1:]
+		default:
+			if pattern[0] == '\\' && len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			if len(key) == 0 || key[0] != pattern[0] {
+				return false
+			}
+			pattern, key = pattern[1:], key[1:]
+		}
+	}
+	return len(key) == 0
+}
+
+// matchClass matches c against the class at the start of pattern, just past
+// the opening bracket. It returns the pattern after the closing bracket, and
+// ok is false if the class is not terminated.
+func matchClass(pattern string, c byte) (matched bool, rest string, ok bool) {
+	negate := false
+	if len(pattern) > 0 && pattern[0] == '^' {
+		negate = true
+		pattern = pattern[1:]
+	}
+
+	for len(pattern) > 0 {
+		if pattern[0] == ']' {
+			return matched != negate, pattern[1:], true
+		}
+
+		lo := pattern[0]
+		if lo == '\\' && len(pattern) > 1 {
+			pattern = pattern[1:]
+			lo = pattern[0]
+		}
+		pattern = pattern[1:]
+
+		hi := lo
+		if len(pattern) > 1 && pattern[0] == '-' && pattern[1] != ']' {
+			hi = pattern[1]
+			pattern = pattern[2:]
+		}
+		if lo > hi {
+			lo, hi = hi, lo
+		}
+		if c >= lo && c <= hi {
+			matched = true
+		}
+	}
+	return false, "", false
+}
+
+// collectKeys gathers the distinct keys visited by a Scan, sorted
+func collectKeys(ctx context.Context, scan func(ctx context.Context, pattern string, fn func(key string) bool) error, pattern string) ([]string, error) {
+	seen := make(map[string]struct{})
+	err := scan(ctx, pattern, func(key string) bool {
+		seen[key] = struct{}{}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
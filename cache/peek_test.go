@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPeek(t *testing.T) {
+	ctx := context.Background()
+	backends := map[string]Cache{
+		"memory":  newMemoryCache(Config{}),
+		"sharded": newShardedCache(Config{Shards: 4}),
+		"disk":    newTestDiskCache(t, filepath.Join(t.TempDir(), "cache.log")),
+		"redis":   newTestRedisCache(t),
+	}
+
+	for name, c := range backends {
+		t.Run(name, func(t *testing.T) {
+			c.SetCtx(ctx, "expiring", "a", time.Minute)
+			c.SetCtx(ctx, "forever", "b", 0)
+
+			value, ttl, err := c.Peek(ctx, "expiring")
+			if err != nil || value != "a" || ttl <= 0 || ttl > time.Minute {
+				t.Errorf("Peek(expiring) = %v, %v, %v, want a with a TTL within (0, 1m]", value, ttl, err)
+			}
+			if value, ttl, err := c.Peek(ctx, "forever"); err != nil || value != "b" || ttl != 0 {
+				t.Errorf("Peek(forever) = %v, %v, %v, want b, 0", value, ttl, err)
+			}
+			if _, _, err := c.Peek(ctx, "missing"); !errors.Is(err, ErrKeyNotFound) {
+				t.Errorf("Peek(missing) = %v, want ErrKeyNotFound", err)
+			}
+
+			stats, err := c.Stats(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Hits != 0 || stats.Misses != 0 {
+				t.Errorf("Peek counted %d hits and %d misses", stats.Hits, stats.Misses)
+			}
+		})
+	}
+}
+
+func TestPeekKeepsEvictionOrder(t *testing.T) {
+	ctx := context.Background()
+	c := newMemoryCache(Config{MaxEntries: 2, EvictionPolicy: "lru"})
+	defer c.Close()
+
+	c.Set("old", 1, 0)
+	c.Set("new", 2, 0)
+	c.Peek(ctx, "old")
+	c.Set("third", 3, 0)
+
+	if c.Exists("old") {
+		t.Error("Peek moved the key to the front of the LRU list")
+	}
+}
@@ -1,27 +1,75 @@
 package cache
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 )
 
+// tagKeyPrefix namespaces the Redis sets that index tagged keys
+const tagKeyPrefix = "cache:tag:"
+
+// scanCount is the SCAN page size and DEL batch size for bulk operations
+const scanCount = 100
+
+// incrScript adds to a counter and starts its expiry if it has none
+var incrScript = redis.NewScript(`
+local value = redis.call('INCRBY', KEYS[1], ARGV[1])
+if tonumber(ARGV[2]) > 0 and redis.call('PTTL', KEYS[1]) == -1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return value
+`)
+
+// casScript replaces a value only if it still holds the payload read by CompareAndSwap
+var casScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+else
+	redis.call('SET', KEYS[1], ARGV[2])
+end
+return 1
+`)
+
 // RedisCache implements Redis-based caching
 type RedisCache struct {
-	client *redis.Client
-	ctx    context.Context
+	client    redis.UniversalClient
+	ctx       context.Context
+	stats     recorder
+	listeners redisListeners
 }
 
-// newRedisCache creates a new Redis cache
+// newRedisCache creates a new Redis cache for the configured topology
 func newRedisCache(config Config) (*RedisCache, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:     config.RedisAddr,
-		Password: config.RedisPassword,
-		DB:       config.RedisDB,
-	})
+	client, err := newRedisClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	cache, err := NewRedis(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	cache.stats.observer = config.Observer
+	return cache, nil
+}
 
+// NewRedis creates a Redis cache on an existing client, e.g. one pointed at
+// an in-process Redis stand-in in tests
+func NewRedis(client redis.UniversalClient) (*RedisCache, error) {
 	// Test connection
 	ctx := context.Background()
 	_, err := client.Ping(ctx).Result()
@@ -35,49 +83,599 @@ func newRedisCache(config Config) (*RedisCache, error) {
 	}, nil
 }
 
+// newRedisClient builds a single-node, Sentinel or Cluster client from config
+func newRedisClient(config Config) (redis.UniversalClient, error) {
+	options := redisOptions(config)
+
+	switch config.RedisMode {
+	case "", "single":
+		return redis.NewClient(options.Simple()), nil
+	case "sentinel":
+		if config.RedisMasterName == "" {
+			return nil, errors.New("cache: sentinel mode requires RedisMasterName")
+		}
+		return redis.NewFailoverClient(options.Failover()), nil
+	case "cluster":
+		return redis.NewClusterClient(options.Cluster()), nil
+	}
+	return nil, fmt.Errorf("cache: unknown redis mode %q", config.RedisMode)
+}
+
+// redisOptions maps config onto the options shared by every topology
+func redisOptions(config Config) *redis.UniversalOptions {
+	addrs := config.RedisAddrs
+	if len(addrs) == 0 && config.RedisAddr != "" {
+		addrs = []string{config.RedisAddr}
+	}
+
+	return &redis.UniversalOptions{
+		Addrs:            addrs,
+		DB:               config.RedisDB,
+		Username:         config.RedisUsername,
+		Password:         config.RedisPassword,
+		SentinelPassword: config.RedisSentinelPassword,
+		MasterName:       config.RedisMasterName,
+		TLSConfig:        config.RedisTLS,
+		PoolSize:         config.RedisPoolSize,
+		MinIdleConns:     config.RedisMinIdleConns,
+		PoolTimeout:      config.RedisPoolTimeout,
+		IdleTimeout:      config.RedisIdleTimeout,
+		DialTimeout:      config.RedisDialTimeout,
+		ReadTimeout:      config.RedisReadTimeout,
+		WriteTimeout:     config.RedisWriteTimeout,
+	}
+}
+
 // Set stores a value in Redis with TTL
 func (c *RedisCache) Set(key string, value interface{}, ttl time.Duration) error {
+	return c.SetCtx(c.ctx, key, value, ttl)
+}
+
+// SetCtx stores a value in Redis with TTL, bounded by ctx
+func (c *RedisCache) SetCtx(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
 	// Serialize value to JSON
 	data, err := json.Marshal(value)
 	if err != nil {
 		return err
 	}
 
-	return c.client.Set(c.ctx, key, data, ttl).Err()
+	start := time.Now()
+	err = c.client.Set(ctx, key, data, ttl).Err()
+	c.stats.write(OpSet, key, err, start)
+	return err
 }
 
 // Get retrieves a value from Redis
 func (c *RedisCache) Get(key string) (interface{}, error) {
-	val, err := c.client.Get(c.ctx, key).Result()
+	return c.GetCtx(c.ctx, key)
+}
+
+// GetCtx retrieves a value from Redis, bounded by ctx
+func (c *RedisCache) GetCtx(ctx context.Context, key string) (interface{}, error) {
+	start := time.Now()
+	val, err := c.client.Get(ctx, key).Result()
 	if err == redis.Nil {
-		return nil, ErrKeyNotFound
+		err = ErrKeyNotFound
 	}
+	c.stats.lookup(OpGet, key, err, start)
 	if err != nil {
 		return nil, err
 	}
 
-	// Try to unmarshal as JSON first
-	var result interface{}
-	if err := json.Unmarshal([]byte(val), &result); err != nil {
-		// If not JSON, return as string
-		return val, nil
-	}
-
-	return result, nil
+	return decodeValue(val), nil
 }
 
 // Delete removes a key from Redis
 func (c *RedisCache) Delete(key string) error {
-	return c.client.Del(c.ctx, key).Err()
+	return c.DeleteCtx(c.ctx, key)
+}
+
+// DeleteCtx removes a key from Redis, bounded by ctx
+func (c *RedisCache) DeleteCtx(ctx context.Context, key string) error {
+	start := time.Now()
+	err := c.client.Del(ctx, key).Err()
+	c.stats.remove(OpDelete, key, err, start)
+	return err
 }
 
 // Exists checks if a key exists in Redis
 func (c *RedisCache) Exists(key string) bool {
-	count, err := c.client.Exists(c.ctx, key).Result()
+	return c.ExistsCtx(c.ctx, key)
+}
+
+// ExistsCtx checks if a key exists in Redis, bounded by ctx
+func (c *RedisCache) ExistsCtx(ctx context.Context, key string) bool {
+	count, err := c.client.Exists(ctx, key).Result()
 	return err == nil && count > 0
 }
 
-// Close closes the Redis connection
+// SetWithTags stores a value in Redis with TTL and adds the key to a set per
+// tag. Tag sets are kept alive at least as long as their longest-lived member.
+func (c *RedisCache) SetWithTags(ctx context.Context, key string, value interface{}, ttl time.Duration, tags []string) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	pipe := c.client.Pipeline()
+	pipe.Set(ctx, key, data, ttl)
+	existed := make([]*redis.IntCmd, len(tags))
+	pttls := make([]*redis.DurationCmd, len(tags))
+	for i, tag := range tags {
+		existed[i] = pipe.Exists(ctx, tagKey(tag))
+		pipe.SAdd(ctx, tagKey(tag), key)
+		pttls[i] = pipe.PTTL(ctx, tagKey(tag))
+	}
+	_, err = pipe.Exec(ctx)
+	c.stats.write(OpSet, key, err, start)
+	if err != nil {
+		return err
+	}
+
+	// PTTL is negative for sets without an expiry, which already outlive
+	// every member unless they were just created
+	pipe = c.client.Pipeline()
+	for i, tag := range tags {
+		current := pttls[i].Val()
+		isNew := existed[i].Val() == 0
+		switch {
+		case ttl <= 0 && current > 0:
+			pipe.Persist(ctx, tagKey(tag))
+		case ttl > 0 && (isNew || (current > 0 && current < ttl)):
+			pipe.PExpire(ctx, tagKey(tag), ttl)
+		}
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// InvalidateTag removes every key stored with the tag, and the tag set itself
+func (c *RedisCache) InvalidateTag(ctx context.Context, tag string) error {
+	keys, err := c.client.SMembers(ctx, tagKey(tag)).Result()
+	if err != nil {
+		return err
+	}
+	return c.MDelete(ctx, append(keys, tagKey(tag)))
+}
+
+// DeletePrefix removes every key starting with prefix using SCAN, so the
+// server is never blocked by a KEYS call. In cluster mode every master is scanned.
+func (c *RedisCache) DeletePrefix(ctx context.Context, prefix string) error {
+	if cluster, ok := c.client.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return deletePrefix(ctx, node, prefix)
+		})
+	}
+	return deletePrefix(ctx, c.client, prefix)
+}
+
+// MGet looks up several keys in one pipelined round trip
+func (c *RedisCache) MGet(ctx context.Context, keys []string) ([]Result, error) {
+	start := time.Now()
+	pipe := c.client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Get(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	results := make([]Result, len(keys))
+	for i, cmd := range cmds {
+		results[i].Key = keys[i]
+		val, err := cmd.Result()
+		switch {
+		case err == redis.Nil:
+			results[i].Err = ErrKeyNotFound
+		case err != nil:
+			results[i].Err = err
+		default:
+			results[i].Value = decodeValue(val)
+		}
+		c.stats.lookup(OpMGet, keys[i], results[i].Err, start)
+	}
+	return results, nil
+}
+
+// getWithTTL reads keys along with their remaining lifetimes in one
+// pipelined round trip, for the tiered cache. A lifetime is zero for keys
+// without expiry and negative if the key expired between the two reads.
+func (c *RedisCache) getWithTTL(ctx context.Context, op string, keys []string) ([]Result, []time.Duration, error) {
+	start := time.Now()
+	pipe := c.client.Pipeline()
+	gets := make([]*redis.StringCmd, len(keys))
+	pttls := make([]*redis.DurationCmd, len(keys))
+	for i, key := range keys {
+		gets[i] = pipe.Get(ctx, key)
+		pttls[i] = pipe.PTTL(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, nil, err
+	}
+
+	results := make([]Result, len(keys))
+	ttls := make([]time.Duration, len(keys))
+	for i, cmd := range gets {
+		results[i].Key = keys[i]
+		val, err := cmd.Result()
+		switch {
+		case err == redis.Nil:
+			results[i].Err = ErrKeyNotFound
+		case err != nil:
+			results[i].Err = err
+		default:
+			results[i].Value = decodeValue(val)
+		}
+		c.stats.lookup(op, keys[i], results[i].Err, start)
+
+		// PTTL reports -2 for a missing key and -1 for a key without expiry
+		ttl, err := pttls[i].Result()
+		switch {
+		case err != nil || ttl == -2:
+			ttls[i] = -1
+		case ttl == -1:
+			ttls[i] = 0
+		default:
+			ttls[i] = ttl
+		}
+	}
+	return results, ttls, nil
+}
+
+// MSet stores several entries in one pipelined round trip
+func (c *RedisCache) MSet(ctx context.Context, entries []Entry) error {
+	start := time.Now()
+	pipe := c.client.Pipeline()
+	cmds := make([]*redis.StatusCmd, len(entries))
+	for i, entry := range entries {
+		data, err := json.Marshal(entry.Value)
+		if err != nil {
+			return err
+		}
+		cmds[i] = pipe.Set(ctx, entry.Key, data, entry.TTL)
+	}
+	_, err := pipe.Exec(ctx)
+	for i, cmd := range cmds {
+		c.stats.write(OpMSet, entries[i].Key, cmd.Err(), start)
+	}
+	return err
+}
+
+// MDelete removes several keys in one pipelined round trip. Each key gets its
+// own DEL so batches work across cluster slots.
+func (c *RedisCache) MDelete(ctx context.Context, keys []string) error {
+	start := time.Now()
+	pipe := c.client.Pipeline()
+	cmds := make([]*redis.IntCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Del(ctx, key)
+	}
+	_, err := pipe.Exec(ctx)
+	for i, cmd := range cmds {
+		c.stats.remove(OpMDelete, keys[i], cmd.Err(), start)
+	}
+	return err
+}
+
+// Incr atomically adds delta to an integer counter, creating it if missing
+func (c *RedisCache) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	value, err := incrScript.Run(ctx, c.client, []string{key}, delta, ttlMillis(ttl)).Int64()
+	if err != nil && strings.Contains(err.Error(), "not an integer") {
+		return 0, ErrNotInteger
+	}
+	return value, err
+}
+
+// Decr atomically subtracts delta from an integer counter, creating it if missing
+func (c *RedisCache) Decr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	return c.Incr(ctx, key, -delta, ttl)
+}
+
+// SetNX stores a value only if the key does not exist
+func (c *RedisCache) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+
+	return c.client.SetNX(ctx, key, data, ttl).Result()
+}
+
+// CompareAndSwap replaces the value only if the stored JSON decodes to the
+// same value as the JSON encoding of old. The stored payload is compared in
+// Go, since a value read with Get may re-encode with its fields in another
+// order, and the script then swaps only if that payload is still in place.
+// The key keeps its tags.
+func (c *RedisCache) CompareAndSwap(ctx context.Context, key string, old, new interface{}, ttl time.Duration) (bool, error) {
+	expected, err := json.Marshal(old)
+	if err != nil {
+		return false, err
+	}
+	data, err := json.Marshal(new)
+	if err != nil {
+		return false, err
+	}
+
+	current, err := c.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !sameJSON(current, expected) {
+		return false, nil
+	}
+
+	swapped, err := casScript.Run(ctx, c.client, []string{key}, current, data, ttlMillis(ttl)).Int()
+	if err != nil {
+		return false, err
+	}
+	return swapped == 1, nil
+}
+
+// Stats returns the client-side hit, miss, set and delete counters. Items,
+// Evictions and Expirations come from the server (DBSIZE and INFO stats) and
+// cover every client of the database, summed over masters in cluster mode.
+func (c *RedisCache) Stats(ctx context.Context) (Stats, error) {
+	stats := c.stats.snapshot()
+
+	items, err := c.client.DBSize(ctx).Result()
+	if err != nil {
+		return stats, err
+	}
+	stats.Items = items
+
+	addInfo := func(ctx context.Context, client redis.UniversalClient) error {
+		info, err := client.Info(ctx, "stats").Result()
+		if err != nil {
+			return err
+		}
+		evicted, expired := parseInfoStats(info)
+		atomic.AddUint64(&stats.Evictions, evicted)
+		atomic.AddUint64(&stats.Expirations, expired)
+		return nil
+	}
+
+	if cluster, ok := c.client.(*redis.ClusterClient); ok {
+		err = cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return addInfo(ctx, node)
+		})
+	} else {
+		err = addInfo(ctx, c.client)
+	}
+	return stats, err
+}
+
+// Keys returns the keys matching pattern, sorted, using SCAN rather than KEYS
+func (c *RedisCache) Keys(ctx context.Context, pattern string) ([]string, error) {
+	return collectKeys(ctx, c.Scan, pattern)
+}
+
+// Scan calls fn for each key matching pattern, using SCAN so the server is
+// never blocked. In cluster mode every master is scanned concurrently, but fn
+// is never called concurrently. A key may be visited more than once. The
+// sets indexing tags are skipped.
+func (c *RedisCache) Scan(ctx context.Context, pattern string, fn func(key string) bool) error {
+	if pattern == "" {
+		pattern = "*"
+	}
+
+	var mutex sync.Mutex
+	stopped := false
+	visit := func(key string) bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if !stopped && !fn(key) {
+			stopped = true
+		}
+		return !stopped
+	}
+
+	var err error
+	if cluster, ok := c.client.(*redis.ClusterClient); ok {
+		err = cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return scanKeys(ctx, node, pattern, visit)
+		})
+	} else {
+		err = scanKeys(ctx, c.client, pattern, visit)
+	}
+
+	if errors.Is(err, errScanStopped) {
+		return nil
+	}
+	return err
+}
+
+// TTL returns the remaining lifetime of key, zero if it never expires
+func (c *RedisCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := c.client.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	// PTTL reports -2 for a missing key and -1 for a key without expiry
+	switch ttl {
+	case -2:
+		return 0, ErrKeyNotFound
+	case -1:
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// Peek returns the value and remaining lifetime of key in one round trip,
+// without counting a hit or miss. Redis itself still records the access.
+func (c *RedisCache) Peek(ctx context.Context, key string) (interface{}, time.Duration, error) {
+	pipe := c.client.Pipeline()
+	get := pipe.Get(ctx, key)
+	pttl := pipe.PTTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, 0, err
+	}
+
+	val, err := get.Result()
+	if err == redis.Nil {
+		return nil, 0, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// PTTL reports -1 for a key without expiry
+	ttl := pttl.Val()
+	if ttl < 0 {
+		ttl = 0
+	}
+	return decodeValue(val), ttl, nil
+}
+
+// Expire sets the TTL of an existing key, or removes its expiry if ttl is not positive
+func (c *RedisCache) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	if ttl > 0 {
+		set, err := c.client.PExpire(ctx, key, time.Duration(ttlMillis(ttl))*time.Millisecond).Result()
+		if err != nil {
+			return err
+		}
+		if !set {
+			return ErrKeyNotFound
+		}
+		return nil
+	}
+
+	// PERSIST reports false both for missing keys and keys without expiry
+	pipe := c.client.Pipeline()
+	exists := pipe.Exists(ctx, key)
+	pipe.Persist(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	if exists.Val() == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+// Close closes the Redis connection and any keyevent subscriptions
 func (c *RedisCache) Close() error {
+	c.closeListeners()
 	return c.client.Close()
-}
\ No newline at end of file
+}
+
+// errScanStopped ends a scan when the callback asks to stop
+var errScanStopped = errors.New("scan stopped")
+
+// scanKeys scans one node for keys matching pattern, passing each to visit
+// until it returns false
+func scanKeys(ctx context.Context, client redis.UniversalClient, pattern string, visit func(key string) bool) error {
+	iter := client.Scan(ctx, 0, pattern, scanCount).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		if strings.HasPrefix(key, tagKeyPrefix) {
+			continue
+		}
+		if !visit(key) {
+			return errScanStopped
+		}
+	}
+	return iter.Err()
+}
+
+// deletePrefix scans one node for keys starting with prefix and deletes them
+// in pipelined batches of single-key DELs, which never span cluster slots
+func deletePrefix(ctx context.Context, client redis.UniversalClient, prefix string) error {
+	iter := client.Scan(ctx, 0, escapePattern(prefix)+"*", scanCount).Iterator()
+
+	pipe := client.Pipeline()
+	queued := 0
+	for iter.Next(ctx) {
+		pipe.Del(ctx, iter.Val())
+		queued++
+		if queued == scanCount {
+			if _, err := pipe.Exec(ctx); err != nil {
+				return err
+			}
+			queued = 0
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// parseInfoStats extracts evicted_keys and expired_keys from an INFO stats reply
+func parseInfoStats(info string) (evicted, expired uint64) {
+	for _, line := range strings.Split(info, "\n") {
+		name, value, found := strings.Cut(strings.TrimSpace(line), ":")
+		if !found {
+			continue
+		}
+		switch name {
+		case "evicted_keys":
+			evicted, _ = strconv.ParseUint(value, 10, 64)
+		case "expired_keys":
+			expired, _ = strconv.ParseUint(value, 10, 64)
+		}
+	}
+	return evicted, expired
+}
+
+// decodeValue unmarshals a stored JSON value, returning the raw string if it is not JSON
+func decodeValue(val string) interface{} {
+	var result interface{}
+	if err := json.Unmarshal([]byte(val), &result); err != nil {
+		return val
+	}
+	return result
+}
+
+// sameJSON reports whether two stored payloads decode to the same value the
+// way Get decodes them, so a value read back from a cache compares equal to
+// the payload it was read from even though its map keys re-encode sorted
+func sameJSON(a, b []byte) bool {
+	return bytes.Equal(canonicalJSON(a), canonicalJSON(b))
+}
+
+// canonicalJSON re-encodes a stored payload as decoded by decodeValue
+func canonicalJSON(data []byte) []byte {
+	canonical, err := json.Marshal(decodeValue(string(data)))
+	if err != nil {
+		return data
+	}
+	return canonical
+}
+
+// ttlMillis converts a TTL to whole milliseconds for scripts, rounding
+// sub-millisecond TTLs up so they still expire
+func ttlMillis(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	if ms := ttl.Milliseconds(); ms > 0 {
+		return ms
+	}
+	return 1
+}
+
+// tagKey returns the Redis key of the set holding the keys tagged with tag
+func tagKey(tag string) string {
+	return tagKeyPrefix + tag
+}
+
+// escapePattern escapes glob metacharacters so s matches literally in SCAN MATCH
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
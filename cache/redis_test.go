@@ -0,0 +1,209 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// newRealRedisClient connects to the Redis server at REDIS_ADDR, returning
+// nil if it is not set
+func newRealRedisClient(t *testing.T) *redis.Client {
+	t.Helper()
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		return nil
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// newRealRedisCache returns a cache on the Redis server at REDIS_ADDR, or nil
+// if it is not set. Keys are namespaced per test and deleted when it ends.
+func newRealRedisCache(t *testing.T) Cache {
+	t.Helper()
+	client := newRealRedisClient(t)
+	if client == nil {
+		return nil
+	}
+
+	server, err := NewRedis(client)
+	if err != nil {
+		t.Fatalf("NewRedis: %v", err)
+	}
+	c := NewNamespaced(server, fmt.Sprintf("cachetest-%d", time.Now().UnixNano()), 0)
+	t.Cleanup(func() { c.DeletePrefix(context.Background(), "") })
+	return c
+}
+
+func TestNewRedis(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisCache(t)
+
+	if err := c.SetCtx(ctx, "user:1", map[string]interface{}{"name": "Ann"}, time.Minute); err != nil {
+		t.Fatalf("SetCtx: %v", err)
+	}
+	value, err := c.GetCtx(ctx, "user:1")
+	if err != nil {
+		t.Fatalf("GetCtx: %v", err)
+	}
+	if want := map[string]interface{}{"name": "Ann"}; !reflect.DeepEqual(value, want) {
+		t.Errorf("GetCtx = %v, want %v", value, want)
+	}
+
+	ttl, err := c.TTL(ctx, "user:1")
+	if err != nil || ttl <= 0 || ttl > time.Minute {
+		t.Errorf("TTL = %v, %v, want within (0, 1m]", ttl, err)
+	}
+	if err := c.Expire(ctx, "user:1", 0); err != nil {
+		t.Fatalf("Expire: %v", err)
+	}
+	if ttl, err := c.TTL(ctx, "user:1"); err != nil || ttl != 0 {
+		t.Errorf("TTL after persist = %v, %v, want 0", ttl, err)
+	}
+
+	if err := c.DeleteCtx(ctx, "user:1"); err != nil {
+		t.Fatalf("DeleteCtx: %v", err)
+	}
+	if _, err := c.GetCtx(ctx, "user:1"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("GetCtx after delete = %v, want ErrKeyNotFound", err)
+	}
+	if err := c.Expire(ctx, "user:1", time.Minute); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expire of missing key = %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestNewRedisUnreachable(t *testing.T) {
+	// Reserve a port, then close it so nothing listens there
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: addr, MaxRetries: -1})
+	defer client.Close()
+	if _, err := NewRedis(client); err == nil {
+		t.Fatal("NewRedis succeeded without a server")
+	}
+}
+
+func TestNewRedisFromConfig(t *testing.T) {
+	server := newRedisStandIn(t)
+	c, err := New(Config{Type: "redis", RedisAddr: server.Addr()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close()
+
+	if err := c.Set("greeting", "hello", 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if value, err := c.Get("greeting"); err != nil || value != "hello" {
+		t.Errorf("Get = %v, %v, want hello", value, err)
+	}
+}
+
+func TestNewRedisClientSingle(t *testing.T) {
+	client, err := newRedisClient(Config{
+		RedisAddr:         "cache:6379",
+		RedisDB:           2,
+		RedisUsername:     "app",
+		RedisPassword:     "secret",
+		RedisPoolSize:     7,
+		RedisMinIdleConns: 3,
+		RedisDialTimeout:  time.Second,
+	})
+	if err != nil {
+		t.Fatalf("newRedisClient: %v", err)
+	}
+	defer client.Close()
+
+	single, ok := client.(*redis.Client)
+	if !ok {
+		t.Fatalf("client is %T, want *redis.Client", client)
+	}
+	options := single.Options()
+	if options.Addr != "cache:6379" || options.DB != 2 || options.Username != "app" || options.Password != "secret" {
+		t.Errorf("options = %s/%d %s:%s, want cache:6379/2 app:secret", options.Addr, options.DB, options.Username, options.Password)
+	}
+	if options.PoolSize != 7 || options.MinIdleConns != 3 || options.DialTimeout != time.Second {
+		t.Errorf("pool options = %d/%d/%v, want 7/3/1s", options.PoolSize, options.MinIdleConns, options.DialTimeout)
+	}
+
+	// "single" is the same as leaving the mode empty
+	client, err = newRedisClient(Config{RedisMode: "single", RedisAddrs: []string{"a:6379", "b:6379"}})
+	if err != nil {
+		t.Fatalf("newRedisClient: %v", err)
+	}
+	defer client.Close()
+	if addr := client.(*redis.Client).Options().Addr; addr != "a:6379" {
+		t.Errorf("Addr = %s, want the first of RedisAddrs", addr)
+	}
+}
+
+func TestNewRedisClientSentinel(t *testing.T) {
+	config := Config{
+		RedisMode:             "sentinel",
+		RedisAddrs:            []string{"sentinel-1:26379", "sentinel-2:26379"},
+		RedisPassword:         "secret",
+		RedisSentinelPassword: "sentinel-secret",
+		RedisDB:               1,
+	}
+	if _, err := newRedisClient(config); err == nil {
+		t.Error("sentinel mode without RedisMasterName succeeded")
+	}
+
+	config.RedisMasterName = "primary"
+	client, err := newRedisClient(config)
+	if err != nil {
+		t.Fatalf("newRedisClient: %v", err)
+	}
+	defer client.Close()
+	if _, ok := client.(*redis.Client); !ok {
+		t.Fatalf("client is %T, want a failover *redis.Client", client)
+	}
+
+	// The failover client hides its options, so check the ones it is built from
+	failover := redisOptions(config).Failover()
+	if failover.MasterName != "primary" || !reflect.DeepEqual(failover.SentinelAddrs, config.RedisAddrs) {
+		t.Errorf("failover = %s %v, want primary %v", failover.MasterName, failover.SentinelAddrs, config.RedisAddrs)
+	}
+	if failover.Password != "secret" || failover.SentinelPassword != "sentinel-secret" || failover.DB != 1 {
+		t.Errorf("failover credentials = %s/%s/%d, want secret/sentinel-secret/1", failover.Password, failover.SentinelPassword, failover.DB)
+	}
+}
+
+func TestNewRedisClientCluster(t *testing.T) {
+	addrs := []string{"node-1:6379", "node-2:6379", "node-3:6379"}
+	client, err := newRedisClient(Config{RedisMode: "cluster", RedisAddrs: addrs, RedisPassword: "secret", RedisPoolSize: 5})
+	if err != nil {
+		t.Fatalf("newRedisClient: %v", err)
+	}
+	defer client.Close()
+
+	cluster, ok := client.(*redis.ClusterClient)
+	if !ok {
+		t.Fatalf("client is %T, want *redis.ClusterClient", client)
+	}
+	options := cluster.Options()
+	if !reflect.DeepEqual(options.Addrs, addrs) || options.Password != "secret" || options.PoolSize != 5 {
+		t.Errorf("options = %v %s %d, want %v secret 5", options.Addrs, options.Password, options.PoolSize, addrs)
+	}
+}
+
+func TestNewRedisClientUnknownMode(t *testing.T) {
+	if _, err := newRedisClient(Config{RedisMode: "ring", RedisAddr: "cache:6379"}); err == nil {
+		t.Error("unknown mode succeeded")
+	}
+}
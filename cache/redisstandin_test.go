@@ -0,0 +1,436 @@
+package cache
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// redisStandIn is a minimal in-process Redis server speaking RESP2, with
+// just the string commands RedisCache relies on, plus INFO for Stats. Every
+// command runs under a single mutex, so commands are atomic as they are in
+// Redis. Lua cannot run here, so the package's scripts are implemented
+// natively and matched by their SHA1, as EVALSHA does. Tests against the
+// stand-in therefore check the Go side of RedisCache and the intended script
+// semantics, not the Lua bodies; set REDIS_ADDR to also run the tests that
+// use newRealRedisCache against a real server.
+type redisStandIn struct {
+	listener net.Listener
+
+	mutex   sync.Mutex
+	data    map[string]standInEntry
+	scripts map[string]func(keys, args []string) interface{}
+}
+
+// standInEntry is a stored string value
+type standInEntry struct {
+	value     string
+	expiresAt time.Time // zero never expires
+}
+
+// standInStatus is a simple string reply such as OK
+type standInStatus string
+
+// standInError is an error reply
+type standInError string
+
+// newRedisStandIn starts a stand-in server that stops when the test ends
+func newRedisStandIn(t testing.TB) *redisStandIn {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	s := &redisStandIn{listener: listener, data: make(map[string]standInEntry)}
+	s.scripts = map[string]func(keys, args []string) interface{}{
+		incrScript.Hash():    s.incrScript,
+		casScript.Hash():     s.casScript,
+		acquireScript.Hash(): s.acquireScript,
+		releaseScript.Hash(): s.releaseScript,
+		extendScript.Hash():  s.extendScript,
+	}
+
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+// Addr returns the address the stand-in listens on
+func (s *redisStandIn) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// newTestRedisCache returns a RedisCache connected to a fresh stand-in
+func newTestRedisCache(t testing.TB) *RedisCache {
+	t.Helper()
+	server := newRedisStandIn(t)
+	c, err := NewRedis(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	if err != nil {
+		t.Fatalf("NewRedis: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// serve accepts connections until the listener is closed
+func (s *redisStandIn) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle answers the commands sent on one connection
+func (s *redisStandIn) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+
+	for {
+		args, err := readStandInCommand(reader)
+		if err != nil {
+			return
+		}
+
+		s.mutex.Lock()
+		reply := s.exec(args)
+		s.mutex.Unlock()
+
+		writeStandInReply(writer, reply)
+		// Flush once the pipelined commands already received are answered
+		if reader.Buffered() == 0 {
+			if err := writer.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// exec runs one command. Callers must hold the mutex.
+func (s *redisStandIn) exec(args []string) interface{} {
+	if len(args) == 0 {
+		return standInError("ERR empty command")
+	}
+
+	name, args := strings.ToUpper(args[0]), args[1:]
+	switch name {
+	case "PING":
+		return standInStatus("PONG")
+	case "GET":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		entry, ok := s.lookup(args[0])
+		if !ok {
+			return nil
+		}
+		return entry.value
+	case "SET":
+		return s.set(args)
+	case "SETNX":
+		if len(args) != 2 {
+			return wrongArgs(name)
+		}
+		if _, ok := s.lookup(args[0]); ok {
+			return int64(0)
+		}
+		s.data[args[0]] = standInEntry{value: args[1]}
+		return int64(1)
+	case "DEL", "EXISTS":
+		var count int64
+		for _, key := range args {
+			if _, ok := s.lookup(key); ok {
+				count++
+				if name == "DEL" {
+					delete(s.data, key)
+				}
+			}
+		}
+		return count
+	case "PTTL":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		entry, ok := s.lookup(args[0])
+		switch {
+		case !ok:
+			return int64(-2)
+		case entry.expiresAt.IsZero():
+			return int64(-1)
+		}
+		return int64(time.Until(entry.expiresAt) / time.Millisecond)
+	case "PEXPIRE":
+		if len(args) != 2 {
+			return wrongArgs(name)
+		}
+		ms, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return standInError("ERR value is not an integer or out of range")
+		}
+		return s.expire(args[0], time.Now().Add(time.Duration(ms)*time.Millisecond))
+	case "PERSIST":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		entry, ok := s.lookup(args[0])
+		if !ok || entry.expiresAt.IsZero() {
+			return int64(0)
+		}
+		entry.expiresAt = time.Time{}
+		s.data[args[0]] = entry
+		return int64(1)
+	case "INCRBY":
+		if len(args) != 2 {
+			return wrongArgs(name)
+		}
+		delta, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return standInError("ERR value is not an integer or out of range")
+		}
+		return s.incrBy(args[0], delta)
+	case "EVALSHA", "EVAL":
+		if len(args) < 2 {
+			return wrongArgs(name)
+		}
+		sha := args[0]
+		if name == "EVAL" {
+			sum := sha1.Sum([]byte(args[0]))
+			sha = hex.EncodeToString(sum[:])
+		}
+		script, ok := s.scripts[sha]
+		if !ok {
+			return standInError("NOSCRIPT No matching script. Please use EVAL.")
+		}
+		numKeys, err := strconv.Atoi(args[1])
+		if err != nil || numKeys < 0 || numKeys > len(args)-2 {
+			return standInError("ERR Number of keys can't be greater than number of args")
+		}
+		return script(args[2:2+numKeys], args[2+numKeys:])
+	case "INFO":
+		// Nothing is evicted, and expired keys are dropped lazily without counting
+		return "# Stats\r\nexpired_keys:0\r\nevicted_keys:0\r\n"
+	case "DBSIZE":
+		var count int64
+		for key := range s.data {
+			if _, ok := s.lookup(key); ok {
+				count++
+			}
+		}
+		return count
+	}
+	return standInError(fmt.Sprintf("ERR unknown command '%s'", strings.ToLower(name)))
+}
+
+// set implements SET key value [EX seconds|PX milliseconds|KEEPTTL] [NX|XX]
+func (s *redisStandIn) set(args []string) interface{} {
+	if len(args) < 2 {
+		return wrongArgs("SET")
+	}
+	key, value := args[0], args[1]
+	current, exists := s.lookup(key)
+
+	entry := standInEntry{value: value}
+	var nx, xx bool
+	for i := 2; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); option {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "KEEPTTL":
+			entry.expiresAt = current.expiresAt
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return standInError("ERR syntax error")
+			}
+			i++
+			n, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil || n <= 0 {
+				return standInError("ERR invalid expire time in 'set' command")
+			}
+			unit := time.Second
+			if option == "PX" {
+				unit = time.Millisecond
+			}
+			entry.expiresAt = time.Now().Add(time.Duration(n) * unit)
+		default:
+			return standInError("ERR syntax error")
+		}
+	}
+
+	if (nx && exists) || (xx && !exists) {
+		return nil
+	}
+	s.data[key] = entry
+	return standInStatus("OK")
+}
+
+// incrBy adds delta to an integer value, creating it if missing
+func (s *redisStandIn) incrBy(key string, delta int64) interface{} {
+	entry, exists := s.lookup(key)
+	current := int64(0)
+	if exists {
+		var err error
+		if current, err = strconv.ParseInt(entry.value, 10, 64); err != nil {
+			return standInError("ERR value is not an integer or out of range")
+		}
+	}
+	entry.value = strconv.FormatInt(current+delta, 10)
+	s.data[key] = entry
+	return current + delta
+}
+
+// expire sets the expiry of an existing key
+func (s *redisStandIn) expire(key string, at time.Time) int64 {
+	entry, ok := s.lookup(key)
+	if !ok {
+		return 0
+	}
+	entry.expiresAt = at
+	s.data[key] = entry
+	return 1
+}
+
+// lookup returns the live entry for key, dropping it if expired
+func (s *redisStandIn) lookup(key string) (standInEntry, bool) {
+	entry, ok := s.data[key]
+	if !ok {
+		return standInEntry{}, false
+	}
+	if !entry.expiresAt.IsZero() && !time.Now().Before(entry.expiresAt) {
+		delete(s.data, key)
+		return standInEntry{}, false
+	}
+	return entry, true
+}
+
+// incrScript mirrors the Lua incrScript
+func (s *redisStandIn) incrScript(keys, args []string) interface{} {
+	delta, _ := strconv.ParseInt(args[0], 10, 64)
+	ttl, _ := strconv.ParseInt(args[1], 10, 64)
+
+	value := s.incrBy(keys[0], delta)
+	if _, failed := value.(standInError); failed {
+		return value
+	}
+	if entry, _ := s.lookup(keys[0]); ttl > 0 && entry.expiresAt.IsZero() {
+		s.expire(keys[0], time.Now().Add(time.Duration(ttl)*time.Millisecond))
+	}
+	return value
+}
+
+// casScript mirrors the Lua casScript
+func (s *redisStandIn) casScript(keys, args []string) interface{} {
+	entry, ok := s.lookup(keys[0])
+	if !ok || entry.value != args[0] {
+		return int64(0)
+	}
+
+	next := standInEntry{value: args[1]}
+	if ttl, _ := strconv.ParseInt(args[2], 10, 64); ttl > 0 {
+		next.expiresAt = time.Now().Add(time.Duration(ttl) * time.Millisecond)
+	}
+	s.data[keys[0]] = next
+	return int64(1)
+}
+
+// acquireScript mirrors the Lua acquireScript
+func (s *redisStandIn) acquireScript(keys, args []string) interface{} {
+	if reply := s.set([]string{keys[0], args[0], "PX", args[1], "NX"}); reply == nil {
+		return int64(0)
+	}
+	return s.incrBy(keys[1], 1)
+}
+
+// releaseScript mirrors the Lua releaseScript
+func (s *redisStandIn) releaseScript(keys, args []string) interface{} {
+	if entry, ok := s.lookup(keys[0]); !ok || entry.value != args[0] {
+		return int64(0)
+	}
+	delete(s.data, keys[0])
+	return int64(1)
+}
+
+// extendScript mirrors the Lua extendScript
+func (s *redisStandIn) extendScript(keys, args []string) interface{} {
+	if entry, ok := s.lookup(keys[0]); !ok || entry.value != args[0] {
+		return int64(0)
+	}
+	ms, _ := strconv.ParseInt(args[1], 10, 64)
+	return s.expire(keys[0], time.Now().Add(time.Duration(ms)*time.Millisecond))
+}
+
+// wrongArgs is the error for a command called with the wrong arity
+func wrongArgs(name string) standInError {
+	return standInError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+}
+
+// readStandInCommand reads one command sent as a RESP array of bulk strings
+func readStandInCommand(reader *bufio.Reader) ([]string, error) {
+	count, err := readStandInHeader(reader, '*')
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, count)
+	for i := range args {
+		size, err := readStandInHeader(reader, '$')
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+// readStandInHeader reads a "<prefix><n>\r\n" line and returns n
+func readStandInHeader(reader *bufio.Reader, prefix byte) (int, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return 0, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if len(line) < 2 || line[0] != prefix {
+		return 0, errors.New("protocol error")
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 {
+		return 0, errors.New("protocol error")
+	}
+	return n, nil
+}
+
+// writeStandInReply encodes a reply in RESP2
+func writeStandInReply(writer *bufio.Writer, reply interface{}) {
+	switch reply := reply.(type) {
+	case nil:
+		writer.WriteString("$-1\r\n")
+	case standInStatus:
+		fmt.Fprintf(writer, "+%s\r\n", reply)
+	case standInError:
+		fmt.Fprintf(writer, "-%s\r\n", reply)
+	case int64:
+		fmt.Fprintf(writer, ":%d\r\n", reply)
+	case string:
+		fmt.Fprintf(writer, "$%d\r\n%s\r\n", len(reply), reply)
+	}
+}
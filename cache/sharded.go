@@ -0,0 +1,345 @@
+package cache
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ShardedCache spreads keys over several MemoryCache shards, each with its
+// own lock, so concurrent operations on different keys rarely contend.
+//
+// Size limits and eviction apply per shard: MaxEntries and MaxBytes are
+// divided evenly, so eviction approximates the configured policy globally.
+type ShardedCache struct {
+	shards []*MemoryCache
+	locker sharedLocker // returned by NewLocker
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// newShardedCache creates Config.Shards memory caches, defaulting to four per CPU
+func newShardedCache(config Config) *ShardedCache {
+	count := config.Shards
+	if count <= 0 {
+		count = 4 * runtime.GOMAXPROCS(0)
+	}
+
+	interval := config.CleanupInterval
+	if interval == 0 {
+		interval = defaultCleanupInterval
+	}
+
+	// Shards share one cleanup goroutine instead of running their own
+	shardConfig := config
+	shardConfig.CleanupInterval = -1
+	shardConfig.MaxEntries = int(divideLimit(int64(config.MaxEntries), count))
+	shardConfig.MaxBytes = divideLimit(config.MaxBytes, count)
+
+	cache := &ShardedCache{
+		shards: make([]*MemoryCache, count),
+		stop:   make(chan struct{}),
+	}
+	for i := range cache.shards {
+		cache.shards[i] = newMemoryCache(shardConfig)
+	}
+
+	if interval > 0 {
+		go cache.cleanup(interval)
+	}
+
+	return cache
+}
+
+// divideLimit splits a limit over count shards, rounding up; zero stays unlimited
+func divideLimit(limit int64, count int) int64 {
+	if limit <= 0 {
+		return limit
+	}
+	return (limit + int64(count) - 1) / int64(count)
+}
+
+// shard returns the shard owning key, using FNV-1a
+func (c *ShardedCache) shard(key string) *MemoryCache {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return c.shards[hash%uint32(len(c.shards))]
+}
+
+// Set stores a value in the key's shard with TTL
+func (c *ShardedCache) Set(key string, value interface{}, ttl time.Duration) error {
+	return c.shard(key).Set(key, value, ttl)
+}
+
+// Get retrieves a value from the key's shard
+func (c *ShardedCache) Get(key string) (interface{}, error) {
+	return c.shard(key).Get(key)
+}
+
+// Delete removes a key from its shard
+func (c *ShardedCache) Delete(key string) error {
+	return c.shard(key).Delete(key)
+}
+
+// Exists checks if a key exists in its shard
+func (c *ShardedCache) Exists(key string) bool {
+	return c.shard(key).Exists(key)
+}
+
+// SetCtx stores a value in the key's shard with TTL unless ctx is already done
+func (c *ShardedCache) SetCtx(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return c.shard(key).SetCtx(ctx, key, value, ttl)
+}
+
+// GetCtx retrieves a value from the key's shard unless ctx is already done
+func (c *ShardedCache) GetCtx(ctx context.Context, key string) (interface{}, error) {
+	return c.shard(key).GetCtx(ctx, key)
+}
+
+// DeleteCtx removes a key from its shard unless ctx is already done
+func (c *ShardedCache) DeleteCtx(ctx context.Context, key string) error {
+	return c.shard(key).DeleteCtx(ctx, key)
+}
+
+// ExistsCtx checks if a key exists in its shard
+func (c *ShardedCache) ExistsCtx(ctx context.Context, key string) bool {
+	return c.shard(key).ExistsCtx(ctx, key)
+}
+
+// SetWithTags stores a tagged value in the key's shard
+func (c *ShardedCache) SetWithTags(ctx context.Context, key string, value interface{}, ttl time.Duration, tags []string) error {
+	return c.shard(key).SetWithTags(ctx, key, value, ttl, tags)
+}
+
+// InvalidateTag removes every key stored with the tag from all shards
+func (c *ShardedCache) InvalidateTag(ctx context.Context, tag string) error {
+	for _, shard := range c.shards {
+		if err := shard.InvalidateTag(ctx, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeletePrefix removes every key starting with prefix from all shards
+func (c *ShardedCache) DeletePrefix(ctx context.Context, prefix string) error {
+	for _, shard := range c.shards {
+		if err := shard.DeletePrefix(ctx, prefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MGet looks up keys with one batch per shard
+func (c *ShardedCache) MGet(ctx context.Context, keys []string) ([]Result, error) {
+	groups := make(map[*MemoryCache][]int)
+	for i, key := range keys {
+		shard := c.shard(key)
+		groups[shard] = append(groups[shard], i)
+	}
+
+	results := make([]Result, len(keys))
+	for shard, positions := range groups {
+		shardKeys := make([]string, len(positions))
+		for i, position := range positions {
+			shardKeys[i] = keys[position]
+		}
+
+		shardResults, err := shard.MGet(ctx, shardKeys)
+		if err != nil {
+			return nil, err
+		}
+		for i, position := range positions {
+			results[position] = shardResults[i]
+		}
+	}
+	return results, nil
+}
+
+// MSet stores entries with one batch per shard
+func (c *ShardedCache) MSet(ctx context.Context, entries []Entry) error {
+	groups := make(map[*MemoryCache][]Entry)
+	for _, entry := range entries {
+		shard := c.shard(entry.Key)
+		groups[shard] = append(groups[shard], entry)
+	}
+
+	for shard, group := range groups {
+		if err := shard.MSet(ctx, group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MDelete removes keys with one batch per shard
+func (c *ShardedCache) MDelete(ctx context.Context, keys []string) error {
+	groups := make(map[*MemoryCache][]string)
+	for _, key := range keys {
+		shard := c.shard(key)
+		groups[shard] = append(groups[shard], key)
+	}
+
+	for shard, group := range groups {
+		if err := shard.MDelete(ctx, group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Incr atomically adds delta to an integer counter in the key's shard
+func (c *ShardedCache) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	return c.shard(key).Incr(ctx, key, delta, ttl)
+}
+
+// Decr atomically subtracts delta from an integer counter in the key's shard
+func (c *ShardedCache) Decr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	return c.shard(key).Decr(ctx, key, delta, ttl)
+}
+
+// SetNX stores a value in the key's shard only if the key does not exist
+func (c *ShardedCache) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	return c.shard(key).SetNX(ctx, key, value, ttl)
+}
+
+// CompareAndSwap replaces the value in the key's shard only if it equals old
+func (c *ShardedCache) CompareAndSwap(ctx context.Context, key string, old, new interface{}, ttl time.Duration) (bool, error) {
+	return c.shard(key).CompareAndSwap(ctx, key, old, new, ttl)
+}
+
+// Keys returns the live keys matching pattern across all shards, sorted
+func (c *ShardedCache) Keys(ctx context.Context, pattern string) ([]string, error) {
+	var keys []string
+	for _, shard := range c.shards {
+		shardKeys, err := shard.Keys(ctx, pattern)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, shardKeys...)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Scan calls fn for each live key matching pattern across all shards, in sorted order
+func (c *ShardedCache) Scan(ctx context.Context, pattern string, fn func(key string) bool) error {
+	keys, err := c.Keys(ctx, pattern)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !fn(key) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// TTL returns the remaining lifetime of key, zero if it never expires
+func (c *ShardedCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return c.shard(key).TTL(ctx, key)
+}
+
+// Peek returns the value and remaining lifetime of key from the key's shard
+func (c *ShardedCache) Peek(ctx context.Context, key string) (interface{}, time.Duration, error) {
+	return c.shard(key).Peek(ctx, key)
+}
+
+// Expire sets the TTL of an existing key, or removes its expiry if ttl is not positive
+func (c *ShardedCache) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	return c.shard(key).Expire(ctx, key, ttl)
+}
+
+// Stats returns the counters summed over all shards
+func (c *ShardedCache) Stats(ctx context.Context) (Stats, error) {
+	var total Stats
+	for _, shard := range c.shards {
+		stats, err := shard.Stats(ctx)
+		if err != nil {
+			return total, err
+		}
+		total.Hits += stats.Hits
+		total.Misses += stats.Misses
+		total.Sets += stats.Sets
+		total.Deletes += stats.Deletes
+		total.Evictions += stats.Evictions
+		total.Expirations += stats.Expirations
+		total.Items += stats.Items
+		total.Bytes += stats.Bytes
+	}
+	return total, nil
+}
+
+// OnEvict registers fn with every shard
+func (c *ShardedCache) OnEvict(fn RemovalFunc) error {
+	for _, shard := range c.shards {
+		shard.OnEvict(fn)
+	}
+	return nil
+}
+
+// OnExpire registers fn with every shard
+func (c *ShardedCache) OnExpire(fn RemovalFunc) error {
+	for _, shard := range c.shards {
+		shard.OnExpire(fn)
+	}
+	return nil
+}
+
+// Evictions returns the number of entries evicted across all shards
+func (c *ShardedCache) Evictions() uint64 {
+	var total uint64
+	for _, shard := range c.shards {
+		total += shard.Evictions()
+	}
+	return total
+}
+
+// timeSource returns the Clock the shards keep time with
+func (c *ShardedCache) timeSource() Clock {
+	return c.shards[0].clock
+}
+
+// DeleteExpired removes every expired item from all shards
+func (c *ShardedCache) DeleteExpired() {
+	for _, shard := range c.shards {
+		shard.DeleteExpired()
+	}
+}
+
+// Close stops the cleanup goroutine
+func (c *ShardedCache) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.stop)
+	})
+	for _, shard := range c.shards {
+		shard.Close()
+	}
+	return nil
+}
+
+// cleanup sweeps one shard at a time so only one lock is held at once
+func (c *ShardedCache) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.DeleteExpired()
+		case <-c.stop:
+			return
+		}
+	}
+}
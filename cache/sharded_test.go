@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// benchmarkKeys is the key space the parallel benchmarks spread over
+const benchmarkKeys = 1024
+
+func BenchmarkMemoryCache(b *testing.B) {
+	c, err := New(Config{Type: "memory"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer c.Close()
+	benchmarkGetSet(b, c)
+}
+
+func BenchmarkShardedCache(b *testing.B) {
+	c, err := New(Config{Type: "sharded"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer c.Close()
+	benchmarkGetSet(b, c)
+}
+
+// benchmarkGetSet runs a parallel mix of nine Gets to one Set
+func benchmarkGetSet(b *testing.B, c Cache) {
+	ctx := context.Background()
+	keys := make([]string, benchmarkKeys)
+	for i := range keys {
+		keys[i] = "key:" + strconv.Itoa(i)
+		c.SetCtx(ctx, keys[i], i, time.Hour)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := keys[i%len(keys)]
+			if i%10 == 0 {
+				c.SetCtx(ctx, key, i, time.Hour)
+			} else {
+				c.GetCtx(ctx, key)
+			}
+			i++
+		}
+	})
+}
+
+func TestShardedCacheConcurrent(t *testing.T) {
+	const (
+		workers    = 16
+		iterations = 500
+		maxEntries = 256
+	)
+
+	ctx := context.Background()
+	c := newShardedCache(Config{Shards: 8, MaxEntries: maxEntries, CleanupInterval: 5 * time.Millisecond})
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				key := "key:" + strconv.Itoa((w*iterations+i)%(2*maxEntries))
+				switch i % 8 {
+				case 0:
+					c.SetCtx(ctx, key, i, time.Millisecond)
+				case 1:
+					c.SetWithTags(ctx, key, i, time.Minute, []string{"tag:" + strconv.Itoa(w%4)})
+				case 2:
+					c.GetCtx(ctx, key)
+				case 3:
+					c.MGet(ctx, []string{key, "key:0", "key:1"})
+				case 4:
+					c.DeleteCtx(ctx, key)
+				case 5:
+					c.InvalidateTag(ctx, "tag:"+strconv.Itoa(i%4))
+				case 6:
+					c.Keys(ctx, "key:1*")
+				case 7:
+					c.Stats(ctx)
+				}
+				if _, err := c.Incr(ctx, "counter", 1, 0); err != nil {
+					t.Errorf("Incr: %v", err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	value, err := c.GetCtx(ctx, "counter")
+	if err != nil {
+		t.Fatalf("GetCtx(counter): %v", err)
+	}
+	if got := cachedInt(value); got != workers*iterations {
+		t.Errorf("counter = %d, want %d", got, workers*iterations)
+	}
+
+	stats, err := c.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	// Each shard holds at most its share of MaxEntries
+	if limit := int64(len(c.shards)) * divideLimit(maxEntries, len(c.shards)); stats.Items > limit {
+		t.Errorf("Items = %d, want at most %d", stats.Items, limit)
+	}
+}
@@ -0,0 +1,133 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Operations reported to an Observer
+const (
+	OpGet     = "get"
+	OpSet     = "set"
+	OpDelete  = "delete"
+	OpMGet    = "mget"
+	OpMSet    = "mset"
+	OpMDelete = "mdelete"
+	OpEvict   = "evict"
+	OpExpire  = "expire"
+	OpCompact = "compact" // disk log compaction; Err reports a failed automatic compaction
+)
+
+// Stats is a snapshot of cache counters
+type Stats struct {
+	Hits        uint64
+	Misses      uint64
+	Sets        uint64
+	Deletes     uint64
+	Evictions   uint64
+	Expirations uint64
+	Items       int64 // number of stored keys
+	Bytes       int64 // estimated size of entries held in process memory; zero for Redis
+}
+
+// HitRatio returns hits / (hits + misses), or 0 before the first lookup
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// Event describes one cache operation reported to an Observer
+type Event struct {
+	Op      string // one of the Op constants
+	Key     string
+	Hit     bool          // lookups only: whether the key was found
+	Err     error         // errors other than ErrKeyNotFound
+	Latency time.Duration // for batch operations, the duration of the whole batch
+}
+
+// Observer receives an Event for every cache operation, e.g. to export
+// metrics. Observers run synchronously on the calling goroutine, sometimes
+// while the cache holds its lock, so they must be fast and must not call
+// back into the cache.
+type Observer interface {
+	Observe(event Event)
+}
+
+// ObserverFunc adapts a function to the Observer interface
+type ObserverFunc func(event Event)
+
+func (f ObserverFunc) Observe(event Event) {
+	f(event)
+}
+
+// recorder keeps operation counters and forwards events to an observer
+type recorder struct {
+	hits        uint64
+	misses      uint64
+	sets        uint64
+	deletes     uint64
+	evictions   uint64
+	expirations uint64
+	observer    Observer
+}
+
+// lookup records the outcome of reading key
+func (r *recorder) lookup(op, key string, err error, start time.Time) {
+	hit := err == nil
+	if hit {
+		atomic.AddUint64(&r.hits, 1)
+	} else if err == ErrKeyNotFound {
+		atomic.AddUint64(&r.misses, 1)
+		err = nil
+	}
+	r.notify(Event{Op: op, Key: key, Hit: hit, Err: err, Latency: time.Since(start)})
+}
+
+// write records a set of key
+func (r *recorder) write(op, key string, err error, start time.Time) {
+	if err == nil {
+		atomic.AddUint64(&r.sets, 1)
+	}
+	r.notify(Event{Op: op, Key: key, Err: err, Latency: time.Since(start)})
+}
+
+// remove records a delete of key
+func (r *recorder) remove(op, key string, err error, start time.Time) {
+	if err == nil {
+		atomic.AddUint64(&r.deletes, 1)
+	}
+	r.notify(Event{Op: op, Key: key, Err: err, Latency: time.Since(start)})
+}
+
+// evicted records that key was evicted to respect size limits
+func (r *recorder) evicted(key string) {
+	atomic.AddUint64(&r.evictions, 1)
+	r.notify(Event{Op: OpEvict, Key: key})
+}
+
+// expired records that key was dropped because its TTL passed
+func (r *recorder) expired(key string) {
+	atomic.AddUint64(&r.expirations, 1)
+	r.notify(Event{Op: OpExpire, Key: key})
+}
+
+func (r *recorder) notify(event Event) {
+	if r.observer != nil {
+		r.observer.Observe(event)
+	}
+}
+
+// snapshot returns the current counters
+func (r *recorder) snapshot() Stats {
+	return Stats{
+		Hits:        atomic.LoadUint64(&r.hits),
+		Misses:      atomic.LoadUint64(&r.misses),
+		Sets:        atomic.LoadUint64(&r.sets),
+		Deletes:     atomic.LoadUint64(&r.deletes),
+		Evictions:   atomic.LoadUint64(&r.evictions),
+		Expirations: atomic.LoadUint64(&r.expirations),
+	}
+}
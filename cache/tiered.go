@@ -0,0 +1,465 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// defaultNearTTL is used when Config.NearTTL is not set
+const defaultNearTTL = 30 * time.Second
+
+// Invalidation messages published by tiered caches are a kind prefix
+// followed by the key or key prefix to drop
+const (
+	invalidateKeyMsg    = "key:"
+	invalidatePrefixMsg = "prefix:"
+)
+
+// TieredCache keeps a short-lived in-process copy of entries stored in a
+// shared remote cache. Reads consult the near (memory) cache first and fall
+// back to the far (Redis) cache, copying hits into the near cache.
+type TieredCache struct {
+	near    *MemoryCache
+	far     Cache
+	nearTTL time.Duration
+	stats   recorder
+
+	bus      InvalidationBus
+	closeBus bool // the bus was created by cache.New and is closed with the cache
+}
+
+// newTieredCache creates a memory cache in front of a Redis cache
+func newTieredCache(config Config) (*TieredCache, error) {
+	// Operations are observed once at the tiered level, not per layer
+	observer := config.Observer
+	config.Observer = nil
+	far, err := newRedisCache(config)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := NewTiered(newMemoryCache(config), far, config.NearTTL)
+	cache.stats.observer = observer
+
+	if config.InvalidationChannel != "" {
+		bus := NewRedisBus(far.client, config.InvalidationChannel)
+		if err := cache.AttachBus(bus); err != nil {
+			far.Close()
+			return nil, err
+		}
+		cache.closeBus = true
+	}
+
+	return cache, nil
+}
+
+// NewTiered layers near in front of far. Entries are kept in near for at
+// most nearTTL, and never beyond their remaining TTL in far; zero uses a 30
+// second default.
+func NewTiered(near *MemoryCache, far Cache, nearTTL time.Duration) *TieredCache {
+	if nearTTL <= 0 {
+		nearTTL = defaultNearTTL
+	}
+	return &TieredCache{
+		near:    near,
+		far:     far,
+		nearTTL: nearTTL,
+	}
+}
+
+// AttachBus subscribes the near cache to invalidations on bus and publishes
+// every Set and Delete on it, so other instances drop their local copies
+func (c *TieredCache) AttachBus(bus InvalidationBus) error {
+	if err := bus.Subscribe(c.invalidate); err != nil {
+		return err
+	}
+	c.bus = bus
+	return nil
+}
+
+// invalidate drops the local copies named by a message published on the bus
+func (c *TieredCache) invalidate(msg string) {
+	switch {
+	case strings.HasPrefix(msg, invalidateKeyMsg):
+		c.near.Delete(strings.TrimPrefix(msg, invalidateKeyMsg))
+	case strings.HasPrefix(msg, invalidatePrefixMsg):
+		c.near.DeletePrefix(context.Background(), strings.TrimPrefix(msg, invalidatePrefixMsg))
+	}
+}
+
+// publish notifies other instances that key changed
+func (c *TieredCache) publish(ctx context.Context, key string) error {
+	if c.bus == nil {
+		return nil
+	}
+	return c.bus.Publish(ctx, invalidateKeyMsg+key)
+}
+
+// publishKeys notifies other instances that each of keys changed
+func (c *TieredCache) publishKeys(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		if err := c.publish(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publishPrefix notifies other instances that every key starting with prefix changed
+func (c *TieredCache) publishPrefix(ctx context.Context, prefix string) error {
+	if c.bus == nil {
+		return nil
+	}
+	return c.bus.Publish(ctx, invalidatePrefixMsg+prefix)
+}
+
+// Set stores a value in the far cache with TTL
+func (c *TieredCache) Set(key string, value interface{}, ttl time.Duration) error {
+	return c.SetCtx(context.Background(), key, value, ttl)
+}
+
+// SetCtx stores a value in the far cache and drops the local copy, so the
+// next read caches the value exactly as the far cache returns it
+func (c *TieredCache) SetCtx(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	start := time.Now()
+	err := c.far.SetCtx(ctx, key, value, ttl)
+	c.stats.write(OpSet, key, err, start)
+	if err != nil {
+		return err
+	}
+	c.near.Delete(key)
+	return c.publish(ctx, key)
+}
+
+// Get retrieves a value from the near cache, falling back to the far cache
+func (c *TieredCache) Get(key string) (interface{}, error) {
+	return c.GetCtx(context.Background(), key)
+}
+
+// GetCtx retrieves a value from the near cache, falling back to the far cache
+func (c *TieredCache) GetCtx(ctx context.Context, key string) (interface{}, error) {
+	start := time.Now()
+	value, err := c.get(ctx, key)
+	c.stats.lookup(OpGet, key, err, start)
+	return value, err
+}
+
+// get reads through the near cache into the far cache
+func (c *TieredCache) get(ctx context.Context, key string) (interface{}, error) {
+	if value, err := c.near.GetCtx(ctx, key); err == nil {
+		return value, nil
+	}
+
+	results, ttls, err := c.farGet(ctx, OpGet, []string{key})
+	if err != nil {
+		return nil, err
+	}
+	if results[0].Err != nil {
+		return nil, results[0].Err
+	}
+
+	if ttl, ok := c.localTTL(ttls[0]); ok {
+		c.near.SetCtx(ctx, key, results[0].Value, ttl)
+	}
+	return results[0].Value, nil
+}
+
+// expiringReader is implemented by far caches that can read values together
+// with their remaining lifetimes in one round trip. A lifetime is zero for
+// keys without expiry and negative when it could not be determined.
+type expiringReader interface {
+	getWithTTL(ctx context.Context, op string, keys []string) ([]Result, []time.Duration, error)
+}
+
+// farGet reads keys from the far cache along with their remaining lifetimes
+func (c *TieredCache) farGet(ctx context.Context, op string, keys []string) ([]Result, []time.Duration, error) {
+	if reader, ok := c.far.(expiringReader); ok {
+		return reader.getWithTTL(ctx, op, keys)
+	}
+
+	var results []Result
+	if op == OpGet {
+		value, err := c.far.GetCtx(ctx, keys[0])
+		results = []Result{{Key: keys[0], Value: value, Err: err}}
+	} else {
+		var err error
+		if results, err = c.far.MGet(ctx, keys); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	ttls := make([]time.Duration, len(results))
+	for i, result := range results {
+		if result.Err != nil {
+			continue
+		}
+		ttl, err := c.far.TTL(ctx, result.Key)
+		if err != nil {
+			ttl = -1
+		}
+		ttls[i] = ttl
+	}
+	return results, ttls, nil
+}
+
+// localTTL is how long a far entry with the given remaining lifetime may be
+// kept in the near cache: nearTTL, capped so the local copy never outlives
+// the far entry. Entries of unknown lifetime are not kept.
+func (c *TieredCache) localTTL(farTTL time.Duration) (time.Duration, bool) {
+	switch {
+	case farTTL < 0:
+		return 0, false
+	case farTTL == 0 || farTTL > c.nearTTL:
+		return c.nearTTL, true
+	}
+	return farTTL, true
+}
+
+// Delete removes a key from both caches
+func (c *TieredCache) Delete(key string) error {
+	return c.DeleteCtx(context.Background(), key)
+}
+
+// DeleteCtx removes a key from both caches
+func (c *TieredCache) DeleteCtx(ctx context.Context, key string) error {
+	start := time.Now()
+	c.near.Delete(key)
+	err := c.far.DeleteCtx(ctx, key)
+	c.stats.remove(OpDelete, key, err, start)
+	if err != nil {
+		return err
+	}
+	return c.publish(ctx, key)
+}
+
+// Exists checks if a key exists in either cache
+func (c *TieredCache) Exists(key string) bool {
+	return c.ExistsCtx(context.Background(), key)
+}
+
+// ExistsCtx checks if a key exists in either cache
+func (c *TieredCache) ExistsCtx(ctx context.Context, key string) bool {
+	return c.near.ExistsCtx(ctx, key) || c.far.ExistsCtx(ctx, key)
+}
+
+// SetWithTags stores a tagged value in the far cache and drops the local copy
+func (c *TieredCache) SetWithTags(ctx context.Context, key string, value interface{}, ttl time.Duration, tags []string) error {
+	start := time.Now()
+	err := c.far.SetWithTags(ctx, key, value, ttl, tags)
+	c.stats.write(OpSet, key, err, start)
+	if err != nil {
+		return err
+	}
+	c.near.Delete(key)
+	return c.publish(ctx, key)
+}
+
+// InvalidateTag removes the tagged keys from the far cache. Local copies do
+// not carry tags, so every instance drops its whole near cache.
+func (c *TieredCache) InvalidateTag(ctx context.Context, tag string) error {
+	if err := c.far.InvalidateTag(ctx, tag); err != nil {
+		return err
+	}
+	c.near.DeletePrefix(context.Background(), "")
+	return c.publishPrefix(ctx, "")
+}
+
+// DeletePrefix removes every key starting with prefix from both caches
+func (c *TieredCache) DeletePrefix(ctx context.Context, prefix string) error {
+	c.near.DeletePrefix(context.Background(), prefix)
+	if err := c.far.DeletePrefix(ctx, prefix); err != nil {
+		return err
+	}
+	return c.publishPrefix(ctx, prefix)
+}
+
+// MGet looks up keys in the near cache and fetches the misses from the far
+// cache in a single batch, copying far hits into the near cache
+func (c *TieredCache) MGet(ctx context.Context, keys []string) ([]Result, error) {
+	start := time.Now()
+	results, err := c.mget(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, result := range results {
+		c.stats.lookup(OpMGet, result.Key, result.Err, start)
+	}
+	return results, nil
+}
+
+// mget reads a batch through the near cache into the far cache
+func (c *TieredCache) mget(ctx context.Context, keys []string) ([]Result, error) {
+	results, err := c.near.MGet(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	var positions []int
+	for i, result := range results {
+		if result.Err != nil {
+			missing = append(missing, result.Key)
+			positions = append(positions, i)
+		}
+	}
+	if len(missing) == 0 {
+		return results, nil
+	}
+
+	farResults, ttls, err := c.farGet(ctx, OpMGet, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []Entry
+	for i, result := range farResults {
+		results[positions[i]] = result
+		if result.Err != nil {
+			continue
+		}
+		if ttl, ok := c.localTTL(ttls[i]); ok {
+			found = append(found, Entry{Key: result.Key, Value: result.Value, TTL: ttl})
+		}
+	}
+	c.near.MSet(ctx, found)
+
+	return results, nil
+}
+
+// MSet stores entries in the far cache and drops their local copies
+func (c *TieredCache) MSet(ctx context.Context, entries []Entry) error {
+	start := time.Now()
+	err := c.far.MSet(ctx, entries)
+	for _, entry := range entries {
+		c.stats.write(OpMSet, entry.Key, err, start)
+	}
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, len(entries))
+	for i, entry := range entries {
+		keys[i] = entry.Key
+	}
+	c.near.MDelete(context.Background(), keys)
+	return c.publishKeys(ctx, keys)
+}
+
+// MDelete removes keys from both caches
+func (c *TieredCache) MDelete(ctx context.Context, keys []string) error {
+	start := time.Now()
+	c.near.MDelete(context.Background(), keys)
+	err := c.far.MDelete(ctx, keys)
+	for _, key := range keys {
+		c.stats.remove(OpMDelete, key, err, start)
+	}
+	if err != nil {
+		return err
+	}
+	return c.publishKeys(ctx, keys)
+}
+
+// Incr adds delta to a counter in the far cache and drops the local copy
+func (c *TieredCache) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	value, err := c.far.Incr(ctx, key, delta, ttl)
+	if err != nil {
+		return 0, err
+	}
+	c.near.Delete(key)
+	return value, c.publish(ctx, key)
+}
+
+// Decr subtracts delta from a counter in the far cache and drops the local copy
+func (c *TieredCache) Decr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	return c.Incr(ctx, key, -delta, ttl)
+}
+
+// SetNX stores a value in the far cache only if the key does not exist there
+func (c *TieredCache) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	stored, err := c.far.SetNX(ctx, key, value, ttl)
+	if err != nil || !stored {
+		return stored, err
+	}
+	c.near.Delete(key)
+	return true, c.publish(ctx, key)
+}
+
+// CompareAndSwap swaps the value in the far cache, which is the source of
+// truth; local copies may be stale and are not consulted
+func (c *TieredCache) CompareAndSwap(ctx context.Context, key string, old, new interface{}, ttl time.Duration) (bool, error) {
+	swapped, err := c.far.CompareAndSwap(ctx, key, old, new, ttl)
+	if err != nil || !swapped {
+		return swapped, err
+	}
+	c.near.Delete(key)
+	return true, c.publish(ctx, key)
+}
+
+// Keys returns the keys in the far cache matching pattern
+func (c *TieredCache) Keys(ctx context.Context, pattern string) ([]string, error) {
+	return c.far.Keys(ctx, pattern)
+}
+
+// Scan iterates over the keys in the far cache matching pattern
+func (c *TieredCache) Scan(ctx context.Context, pattern string, fn func(key string) bool) error {
+	return c.far.Scan(ctx, pattern, fn)
+}
+
+// TTL returns the remaining lifetime of key in the far cache
+func (c *TieredCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return c.far.TTL(ctx, key)
+}
+
+// Peek returns the value and remaining lifetime of key in the far cache
+func (c *TieredCache) Peek(ctx context.Context, key string) (interface{}, time.Duration, error) {
+	return c.far.Peek(ctx, key)
+}
+
+// Expire sets the TTL of key in the far cache and drops the local copy, which
+// might otherwise outlive a shortened TTL
+func (c *TieredCache) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	if err := c.far.Expire(ctx, key, ttl); err != nil {
+		return err
+	}
+	c.near.Delete(key)
+	return c.publish(ctx, key)
+}
+
+// Stats returns the tiered hit, miss, set and delete counters, the local
+// evictions and expirations, and the item count of the far cache
+func (c *TieredCache) Stats(ctx context.Context) (Stats, error) {
+	stats := c.stats.snapshot()
+
+	near, err := c.near.Stats(ctx)
+	if err != nil {
+		return stats, err
+	}
+	stats.Evictions = near.Evictions
+	stats.Expirations = near.Expirations
+	stats.Bytes = near.Bytes
+
+	far, err := c.far.Stats(ctx)
+	stats.Items = far.Items
+	return stats, err
+}
+
+// Close closes both caches
+func (c *TieredCache) Close() error {
+	if c.closeBus {
+		c.bus.Close()
+	}
+	c.near.Close()
+	return c.far.Close()
+}
+
+// Near returns the in-process cache
+func (c *TieredCache) Near() *MemoryCache {
+	return c.near
+}
+
+// Far returns the shared remote cache
+func (c *TieredCache) Far() Cache {
+	return c.far
+}
@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// tieredReplicas returns two tiered caches sharing far and, if bus is not
+// nil, the invalidation bus, as two service instances would
+func tieredReplicas(t *testing.T, far Cache, bus InvalidationBus) (*TieredCache, *TieredCache) {
+	t.Helper()
+	replicas := make([]*TieredCache, 2)
+	for i := range replicas {
+		replicas[i] = NewTiered(newTestMemoryCache(t, Config{}), far, time.Minute)
+		if bus != nil {
+			if err := replicas[i].AttachBus(bus); err != nil {
+				t.Fatalf("AttachBus: %v", err)
+			}
+		}
+	}
+	return replicas[0], replicas[1]
+}
+
+// nearHas reports whether the replica holds a local copy of key
+func nearHas(replica *TieredCache, key string) bool {
+	_, _, err := replica.Near().Peek(context.Background(), key)
+	return err == nil
+}
+
+func TestTieredMemoryBusInvalidation(t *testing.T) {
+	ctx := context.Background()
+	far := newTestMemoryCache(t, Config{})
+
+	tests := []struct {
+		name   string
+		keys   []string
+		change func(writer *TieredCache) error
+	}{
+		{"Set", []string{"user:1"}, func(w *TieredCache) error { return w.SetCtx(ctx, "user:1", "changed", 0) }},
+		{"SetWithTags", []string{"user:1"}, func(w *TieredCache) error {
+			return w.SetWithTags(ctx, "user:1", "changed", 0, []string{"users"})
+		}},
+		{"Delete", []string{"user:1"}, func(w *TieredCache) error { return w.DeleteCtx(ctx, "user:1") }},
+		{"MSet", []string{"user:1", "user:2"}, func(w *TieredCache) error {
+			return w.MSet(ctx, []Entry{{Key: "user:1", Value: "a"}, {Key: "user:2", Value: "b"}})
+		}},
+		{"MDelete", []string{"user:1", "user:2"}, func(w *TieredCache) error { return w.MDelete(ctx, []string{"user:1", "user:2"}) }},
+		{"DeletePrefix", []string{"user:1", "user:2"}, func(w *TieredCache) error { return w.DeletePrefix(ctx, "user:") }},
+		{"InvalidateTag", []string{"user:1", "user:2"}, func(w *TieredCache) error { return w.InvalidateTag(ctx, "users") }},
+		{"CompareAndSwap", []string{"user:1"}, func(w *TieredCache) error {
+			_, err := w.CompareAndSwap(ctx, "user:1", "original", "changed", 0)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer, reader := tieredReplicas(t, far, NewMemoryBus())
+			for _, key := range []string{"user:1", "user:2"} {
+				far.SetWithTags(ctx, key, "original", 0, []string{"users"})
+			}
+
+			// The reader caches its own copies, which the writer cannot touch directly
+			for _, key := range tt.keys {
+				if _, err := reader.GetCtx(ctx, key); err != nil {
+					t.Fatalf("Get %s: %v", key, err)
+				}
+				if !nearHas(reader, key) {
+					t.Fatalf("%s was not copied into the reader's near cache", key)
+				}
+			}
+
+			if err := tt.change(writer); err != nil {
+				t.Fatalf("change: %v", err)
+			}
+			for _, key := range tt.keys {
+				if nearHas(reader, key) {
+					t.Errorf("%s is still in the reader's near cache", key)
+				}
+			}
+		})
+	}
+}
+
+func TestTieredMemoryBusServesFreshValue(t *testing.T) {
+	ctx := context.Background()
+	fars := map[string]Cache{
+		"memory": newTestMemoryCache(t, Config{}),
+		"redis":  newTestRedisCache(t),
+	}
+	for name, far := range fars {
+		t.Run(name, func(t *testing.T) {
+			writer, reader := tieredReplicas(t, far, NewMemoryBus())
+
+			writer.SetCtx(ctx, "config", "v1", time.Hour)
+			if value, _ := reader.GetCtx(ctx, "config"); value != "v1" {
+				t.Fatalf("reader Get = %v, want v1", value)
+			}
+			writer.SetCtx(ctx, "config", "v2", time.Hour)
+			if value, _ := reader.GetCtx(ctx, "config"); value != "v2" {
+				t.Errorf("reader Get after the writer's Set = %v, want v2", value)
+			}
+
+			writer.DeleteCtx(ctx, "config")
+			if _, err := reader.GetCtx(ctx, "config"); err != ErrKeyNotFound {
+				t.Errorf("reader Get after the writer's Delete = %v, want ErrKeyNotFound", err)
+			}
+		})
+	}
+}
+
+func TestTieredWithoutBusKeepsNearCopy(t *testing.T) {
+	ctx := context.Background()
+	far := newTestMemoryCache(t, Config{})
+	writer, reader := tieredReplicas(t, far, nil)
+
+	writer.SetCtx(ctx, "config", "v1", 0)
+	reader.GetCtx(ctx, "config")
+	writer.SetCtx(ctx, "config", "v2", 0)
+
+	// Without a bus the reader serves its copy until NearTTL passes
+	if value, _ := reader.GetCtx(ctx, "config"); value != "v1" {
+		t.Errorf("reader Get = %v, want its near copy v1", value)
+	}
+}
+
+func TestMemoryBusClosed(t *testing.T) {
+	bus := NewMemoryBus()
+	delivered := 0
+	bus.Subscribe(func(key string) { delivered++ })
+
+	if err := bus.Publish(context.Background(), "key:a"); err != nil || delivered != 1 {
+		t.Fatalf("Publish = %v with %d deliveries, want nil and 1", err, delivered)
+	}
+	bus.Close()
+	if err := bus.Publish(context.Background(), "key:a"); err != ErrBusClosed {
+		t.Errorf("Publish after Close = %v, want ErrBusClosed", err)
+	}
+	if err := bus.Subscribe(func(string) {}); err != ErrBusClosed {
+		t.Errorf("Subscribe after Close = %v, want ErrBusClosed", err)
+	}
+	if delivered != 1 {
+		t.Errorf("%d deliveries, want none after Close", delivered)
+	}
+}
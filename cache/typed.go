@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+// TypedCache stores values of type T in any Cache using a Codec.
+//
+// Values are encoded to bytes before they reach the backend, so every
+// backend returns exactly the Go type that was stored.
+type TypedCache[T any] struct {
+	cache Cache
+	codec Codec
+}
+
+// NewTyped creates a typed view over cache; a nil codec defaults to JSONCodec
+func NewTyped[T any](cache Cache, codec Codec) *TypedCache[T] {
+	if codec == nil {
+		codec = JSONCodec
+	}
+	return &TypedCache[T]{
+		cache: cache,
+		codec: codec,
+	}
+}
+
+// Set encodes and stores a value with TTL
+func (c *TypedCache[T]) Set(key string, value T, ttl time.Duration) error {
+	return c.SetCtx(context.Background(), key, value, ttl)
+}
+
+// SetCtx encodes and stores a value with TTL, bounded by ctx
+func (c *TypedCache[T]) SetCtx(ctx context.Context, key string, value T, ttl time.Duration) error {
+	data, err := c.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return c.cache.SetCtx(ctx, key, data, ttl)
+}
+
+// SetWithTags encodes and stores a value with TTL, indexing it under tags
+func (c *TypedCache[T]) SetWithTags(ctx context.Context, key string, value T, ttl time.Duration, tags []string) error {
+	data, err := c.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return c.cache.SetWithTags(ctx, key, data, ttl, tags)
+}
+
+// Get retrieves and decodes a value
+func (c *TypedCache[T]) Get(key string) (T, error) {
+	return c.GetCtx(context.Background(), key)
+}
+
+// GetCtx retrieves and decodes a value, bounded by ctx
+func (c *TypedCache[T]) GetCtx(ctx context.Context, key string) (T, error) {
+	var value T
+
+	raw, err := c.cache.GetCtx(ctx, key)
+	if err != nil {
+		return value, err
+	}
+
+	data, err := payloadBytes(raw)
+	if err != nil {
+		return value, err
+	}
+
+	if err := c.codec.Unmarshal(data, &value); err != nil {
+		return value, err
+	}
+	return value, nil
+}
+
+// Delete removes a key
+func (c *TypedCache[T]) Delete(key string) error {
+	return c.cache.Delete(key)
+}
+
+// DeleteCtx removes a key, bounded by ctx
+func (c *TypedCache[T]) DeleteCtx(ctx context.Context, key string) error {
+	return c.cache.DeleteCtx(ctx, key)
+}
+
+// Exists checks if a key exists
+func (c *TypedCache[T]) Exists(key string) bool {
+	return c.cache.Exists(key)
+}
+
+// ExistsCtx checks if a key exists, bounded by ctx
+func (c *TypedCache[T]) ExistsCtx(ctx context.Context, key string) bool {
+	return c.cache.ExistsCtx(ctx, key)
+}
+
+// Cache returns the underlying cache
+func (c *TypedCache[T]) Cache() Cache {
+	return c.cache
+}
+
+// payloadBytes recovers the encoded payload returned by a backend. The memory
+// cache hands back the []byte as stored; JSON-backed stores such as Redis
+// return it as the base64 string encoding/json produces for []byte.
+func payloadBytes(raw interface{}) ([]byte, error) {
+	switch val := raw.(type) {
+	case []byte:
+		return val, nil
+	case string:
+		return base64.StdEncoding.DecodeString(val)
+	}
+	return nil, fmt.Errorf("cache: unexpected payload type %T", raw)
+}
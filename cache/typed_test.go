@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// typedProfile is a value with the field kinds codecs most often disagree on
+type typedProfile struct {
+	Name    string            `json:"name"`
+	Age     int               `json:"age"`
+	Score   float64           `json:"score"`
+	Tags    []string          `json:"tags"`
+	Meta    map[string]string `json:"meta"`
+	Avatar  []byte            `json:"avatar"`
+	Created time.Time         `json:"created"`
+}
+
+// typedCodecs are the codecs every backend must round-trip identically
+var typedCodecs = map[string]Codec{
+	"json":    JSONCodec,
+	"gob":     GobCodec,
+	"msgpack": MsgpackCodec,
+	"custom":  NewCodec(json.Marshal, json.Unmarshal),
+}
+
+// typedBackends returns a memory cache and the backends that store values as JSON
+func typedBackends(t *testing.T) map[string]Cache {
+	memory, err := New(Config{Type: "memory"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { memory.Close() })
+
+	return map[string]Cache{
+		"memory": memory,
+		"redis":  newTestRedisCache(t),
+		"disk":   newTestDiskCache(t, filepath.Join(t.TempDir(), "cache.log")),
+	}
+}
+
+func TestTypedCacheCodecs(t *testing.T) {
+	ctx := context.Background()
+	want := typedProfile{
+		Name:    "ann",
+		Age:     41,
+		Score:   -0.5,
+		Tags:    []string{"admin", "beta"},
+		Meta:    map[string]string{"team": "core"},
+		Avatar:  []byte{0x00, 0xff, 0x10},
+		Created: time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC),
+	}
+
+	for codecName, codec := range typedCodecs {
+		t.Run(codecName, func(t *testing.T) {
+			results := make(map[string]typedProfile)
+			for backendName, backend := range typedBackends(t) {
+				typed := NewTyped[typedProfile](backend, codec)
+				if err := typed.SetCtx(ctx, "profile", want, time.Minute); err != nil {
+					t.Fatalf("%s: SetCtx: %v", backendName, err)
+				}
+				got, err := typed.GetCtx(ctx, "profile")
+				if err != nil {
+					t.Fatalf("%s: GetCtx: %v", backendName, err)
+				}
+				results[backendName] = got
+			}
+
+			for backendName, got := range results {
+				if !reflect.DeepEqual(got, results["memory"]) {
+					t.Errorf("%s returned %+v, memory returned %+v", backendName, got, results["memory"])
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s returned %+v, want %+v", backendName, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTypedCacheRawCodec(t *testing.T) {
+	ctx := context.Background()
+	for backendName, backend := range typedBackends(t) {
+		t.Run(backendName, func(t *testing.T) {
+			blobs := NewTyped[[]byte](backend, RawCodec)
+			if err := blobs.SetCtx(ctx, "blob", []byte{0, 1, 2, 255}, 0); err != nil {
+				t.Fatalf("SetCtx: %v", err)
+			}
+			blob, err := blobs.GetCtx(ctx, "blob")
+			if err != nil || !reflect.DeepEqual(blob, []byte{0, 1, 2, 255}) {
+				t.Errorf("GetCtx = %v, %v; want [0 1 2 255]", blob, err)
+			}
+
+			texts := NewTyped[string](backend, RawCodec)
+			if err := texts.SetCtx(ctx, "text", "héllo", 0); err != nil {
+				t.Fatalf("SetCtx: %v", err)
+			}
+			text, err := texts.GetCtx(ctx, "text")
+			if err != nil || text != "héllo" {
+				t.Errorf("GetCtx = %q, %v; want héllo", text, err)
+			}
+		})
+	}
+
+	if _, err := RawCodec.Marshal(42); err == nil {
+		t.Error("RawCodec.Marshal(42) succeeded")
+	}
+	var n int
+	if err := RawCodec.Unmarshal([]byte("42"), &n); err == nil {
+		t.Error("RawCodec.Unmarshal into *int succeeded")
+	}
+}
+
+func TestTypedCacheMissingKey(t *testing.T) {
+	for backendName, backend := range typedBackends(t) {
+		typed := NewTyped[typedProfile](backend, nil)
+		if _, err := typed.GetCtx(context.Background(), "missing"); err != ErrKeyNotFound {
+			t.Errorf("%s: GetCtx = %v, want ErrKeyNotFound", backendName, err)
+		}
+	}
+}
+
+func TestPayloadBytes(t *testing.T) {
+	payload := []byte{0x00, 0xff, 'x'}
+
+	got, err := payloadBytes(payload)
+	if err != nil || !reflect.DeepEqual(got, payload) {
+		t.Errorf("payloadBytes([]byte) = %v, %v; want %v", got, err, payload)
+	}
+
+	got, err = payloadBytes(base64.StdEncoding.EncodeToString(payload))
+	if err != nil || !reflect.DeepEqual(got, payload) {
+		t.Errorf("payloadBytes(base64) = %v, %v; want %v", got, err, payload)
+	}
+
+	if _, err := payloadBytes("not base64!"); err == nil {
+		t.Error("payloadBytes accepted invalid base64")
+	}
+	if _, err := payloadBytes(map[string]interface{}{}); err == nil {
+		t.Error("payloadBytes accepted a map")
+	}
+}
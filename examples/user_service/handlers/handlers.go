@@ -20,17 +20,29 @@ import (
 	"go.uber.org/zap"
 )
 
+// UsersCacheTag tags every cached user entry and response so writes can drop them in one call
+const UsersCacheTag = "users"
+
 // UserHandler handles user-related operations
 type UserHandler struct {
-	db    *sqlx.DB
-	cache cache.Cache
+	db     *sqlx.DB
+	cache  cache.Cache
+	loader *cache.Loader
 }
 
 // NewUserHandler creates a new user handler
-func NewUserHandler(db *sqlx.DB, cache cache.Cache) *UserHandler {
+func NewUserHandler(db *sqlx.DB, c cache.Cache) *UserHandler {
 	return &UserHandler{
 		db:    db,
-		cache: cache,
+		cache: c,
+		loader: cache.NewLoader(c, cache.LoaderConfig{
+			NegativeTTL: time.Minute,
+			Tags:        []string{UsersCacheTag},
+			StaleTTL:    time.Minute, // serve the old list while a refresh runs
+			OnRefreshError: func(key string, err error) {
+				logger.Error("Failed to refresh cached users", zap.String("key", key), zap.Error(err))
+			},
+		}),
 	}
 }
 
@@ -68,17 +80,7 @@ func (h *UserHandler) logRequest(ctx context.Context, level string, message stri
 func (h *UserHandler) GetUsers(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 	h.logRequest(ctx, "info", "Listing users")
 
-	// Try cache first
-	cacheKey := "users:list"
-	if cached, err := h.cache.Get(cacheKey); err == nil {
-		h.logRequest(ctx, "debug", "Serving from cache")
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(cached.([]byte))
-		return
-	}
-
-	// Query database
-	rows, err := h.db.Query("SELECT id, name, email, created_at, updated_at FROM users ORDER BY created_at DESC")
+	rows, err := h.db.QueryContext(ctx, "SELECT id, name, email, created_at, updated_at FROM users ORDER BY created_at DESC")
 	if err != nil {
 		h.logRequest(ctx, "error", "Failed to query users", zap.Error(err))
 		w.WriteHeader(http.StatusInternalServerError)
@@ -98,14 +100,10 @@ func (h *UserHandler) GetUsers(ctx context.Context, w http.ResponseWriter, r *ht
 		users = append(users, user)
 	}
 
-	// Cache the result
-	response, _ := json.Marshal(users)
-	h.cache.Set(cacheKey, response, 5*time.Minute)
-
 	h.logRequest(ctx, "info", "Users retrieved successfully", zap.Int("count", len(users)))
 
 	w.Header().Set("Content-Type", "application/json")
-	w.Write(response)
+	json.NewEncoder(w).Encode(users)
 }
 
 // GetUser handles GET /users/{id} - get user by ID
@@ -123,21 +121,22 @@ func (h *UserHandler) GetUser(ctx context.Context, w http.ResponseWriter, r *htt
 
 	h.logRequest(ctx, "info", "Getting user", zap.Int("user_id", id))
 
-	// Try cache first
-	cacheKey := "user:" + idStr
-	if cached, err := h.cache.Get(cacheKey); err == nil {
-		h.logRequest(ctx, "debug", "Serving user from cache", zap.Int("user_id", id))
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(cached.([]byte))
-		return
-	}
+	cached, err := h.loader.GetOrLoadCtx(ctx, "user:"+idStr, 10*time.Minute, func(ctx context.Context) (interface{}, error) {
+		var user models.User
+		err := h.db.QueryRowContext(ctx, "SELECT id, name, email, created_at, updated_at FROM users WHERE id = ?", id).
+			Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt, &user.UpdatedAt)
+		if err == sql.ErrNoRows {
+			return nil, cache.ErrKeyNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
 
-	// Query database
-	var user models.User
-	err = h.db.QueryRow("SELECT id, name, email, created_at, updated_at FROM users WHERE id = ?", id).
-		Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt, &user.UpdatedAt)
+		h.logRequest(ctx, "info", "User retrieved successfully", zap.Int("user_id", id))
+		return json.Marshal(user)
+	})
 
-	if err == sql.ErrNoRows {
+	if err == cache.ErrKeyNotFound {
 		h.logRequest(ctx, "info", "User not found", zap.Int("user_id", id))
 		w.WriteHeader(http.StatusNotFound)
 		json.NewEncoder(w).Encode(errs.NewNotFoundError("User not found"))
@@ -150,14 +149,8 @@ func (h *UserHandler) GetUser(ctx context.Context, w http.ResponseWriter, r *htt
 		return
 	}
 
-	// Cache the result
-	response, _ := json.Marshal(user)
-	h.cache.Set(cacheKey, response, 10*time.Minute)
-
-	h.logRequest(ctx, "info", "User retrieved successfully", zap.Int("user_id", id))
-
 	w.Header().Set("Content-Type", "application/json")
-	w.Write(response)
+	w.Write(cached.([]byte))
 }
 
 // CreateUser handles POST /users - create a new user
@@ -193,8 +186,8 @@ func (h *UserHandler) CreateUser(ctx context.Context, w http.ResponseWriter, r *
 	id, _ := result.LastInsertId()
 	userID := int(id)
 
-	// Clear users list cache
-	h.cache.Delete("users:list")
+	// Clear the users list and any cached not-found result for the new ID
+	h.cache.InvalidateTag(ctx, UsersCacheTag)
 
 	h.logRequest(ctx, "info", "User created successfully", zap.Int("user_id", userID))
 
@@ -277,8 +270,7 @@ func (h *UserHandler) UpdateUser(ctx context.Context, w http.ResponseWriter, r *
 	}
 
 	// Clear caches
-	h.cache.Delete("users:list")
-	h.cache.Delete("user:" + idStr)
+	h.cache.InvalidateTag(ctx, UsersCacheTag)
 
 	h.logRequest(ctx, "info", "User updated successfully", zap.Int("user_id", id))
 
@@ -319,8 +311,7 @@ func (h *UserHandler) DeleteUser(ctx context.Context, w http.ResponseWriter, r *
 	}
 
 	// Clear caches
-	h.cache.Delete("users:list")
-	h.cache.Delete("user:" + idStr)
+	h.cache.InvalidateTag(ctx, UsersCacheTag)
 
 	h.logRequest(ctx, "info", "User deleted successfully", zap.Int("user_id", id))
 
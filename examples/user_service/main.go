@@ -5,6 +5,8 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
+	"time"
 
 	"user-service/handlers"
 
@@ -17,26 +19,42 @@ import (
 	"go.uber.org/zap"
 )
 
-// checkAuth implements authentication for the service
-func checkAuth(r *http.Request) (bool, httpserver.RequestAuth) {
-	auth := r.Header.Get("Authorization")
-	if auth == "" {
-		return false, httpserver.RequestAuth{}
+// initializeAuth verifies JWTs against the identity provider's JWKS when
+// JWKS_URL is set, and otherwise HS256 tokens signed with JWT_SECRET
+func initializeAuth() *httpserver.JWTAuthenticator {
+	config := httpserver.JWTConfig{
+		JWKSURL:  os.Getenv("JWKS_URL"),
+		Issuer:   os.Getenv("JWT_ISSUER"),
+		Audience: "user-service",
 	}
 
-	// Simple Bearer token check (in production, validate JWT)
-	if len(auth) > 7 && auth[:7] == "Bearer " {
-		token := auth[7:]
-		if token == "secret-token" { // Simple check for demo
-			return true, httpserver.RequestAuth{
-				Type:   "bearer",
-				Client: "user-service-client",
-				Claims: map[string]interface{}{"service": "user-service"},
-			}
+	if config.JWKSURL == "" {
+		secret := os.Getenv("JWT_SECRET")
+		if secret == "" {
+			secret = "dev-secret" // Demo only; never ship a default secret
 		}
+		config.Secret = []byte(secret)
+
+		// Print a token so the service can be tried out with curl
+		token, err := httpserver.SignJWT(map[string]interface{}{
+			"iss":   config.Issuer,
+			"sub":   "user-service-client",
+			"aud":   config.Audience,
+			"exp":   time.Now().Add(24 * time.Hour).Unix(),
+			"scope": "users:read users:write",
+			"roles": []string{"admin"},
+		}, config.Secret, "")
+		if err != nil {
+			log.Fatalf("Failed to sign demo token: %v", err)
+		}
+		logger.Info("Demo token", zap.String("token", token))
 	}
 
-	return false, httpserver.RequestAuth{}
+	authenticator, err := httpserver.NewJWTAuthenticator(config)
+	if err != nil {
+		log.Fatalf("Failed to configure authentication: %v", err)
+	}
+	return authenticator
 }
 
 func initializeDatabase() *sqlx.DB {
@@ -83,17 +101,33 @@ func main() {
 
 	// Initialize database
 	dbConn := initializeDatabase()
-	defer dbConn.Close()
 
 	// Initialize cache
 	cache := initializeCache()
-	defer cache.Close()
 
 	// Initialize handlers
 	userHandler := handlers.NewUserHandler(dbConn, cache)
 
-	// Create HTTP server with authentication
-	server := httpserver.New("8080", checkAuth)
+	// Cache the user list response; the Authorization header is part of the key
+	// so each client only sees responses produced for its own credentials
+	responseCache := httpserver.NewResponseCache(cache, httpserver.ResponseCacheConfig{
+		TTL:         5 * time.Minute,
+		VaryHeaders: []string{"Authorization"},
+		Tags:        []string{handlers.UsersCacheTag},
+	})
+
+	// Create HTTP server with JWT bearer authentication
+	server := httpserver.New("8080", nil)
+	server.RegisterAuthenticator(httpserver.AuthBearer, initializeAuth())
+	server.SetDrainTimeout(15 * time.Second)
+
+	// Close the database and cache once in-flight requests have drained
+	server.OnShutdown(func(ctx context.Context) error {
+		return dbConn.Close()
+	})
+	server.OnShutdown(func(ctx context.Context) error {
+		return cache.Close()
+	})
 
 	// Register routes
 	server.Register(httpserver.Route{
@@ -108,10 +142,19 @@ func main() {
 	}))
 
 	server.Register(httpserver.Route{
-		Name:     "ListUsers",
+		Name:     "Readiness",
 		Method:   "GET",
-		Path:     "/users",
-		AuthType: "bearer",
+		Path:     "/ready",
+		AuthType: "none",
+	}, server.ReadinessHandler())
+
+	server.Register(httpserver.Route{
+		Name:       "ListUsers",
+		Method:     "GET",
+		Path:       "/users",
+		AuthType:   "bearer",
+		Scopes:     []string{"users:read"},
+		Middleware: []httpserver.Middleware{responseCache.Wrap},
 	}, httpserver.HandlerFunc(userHandler.GetUsers))
 
 	server.Register(httpserver.Route{
@@ -119,6 +162,7 @@ func main() {
 		Method:   "GET",
 		Path:     "/users/{id}",
 		AuthType: "bearer",
+		Scopes:   []string{"users:read"},
 	}, httpserver.HandlerFunc(userHandler.GetUser))
 
 	server.Register(httpserver.Route{
@@ -126,6 +170,7 @@ func main() {
 		Method:   "POST",
 		Path:     "/users",
 		AuthType: "bearer",
+		Scopes:   []string{"users:write"},
 	}, httpserver.HandlerFunc(userHandler.CreateUser))
 
 	server.Register(httpserver.Route{
@@ -133,6 +178,7 @@ func main() {
 		Method:   "PUT",
 		Path:     "/users/{id}",
 		AuthType: "bearer",
+		Scopes:   []string{"users:write"},
 	}, httpserver.HandlerFunc(userHandler.UpdateUser))
 
 	server.Register(httpserver.Route{
@@ -140,14 +186,19 @@ func main() {
 		Method:   "DELETE",
 		Path:     "/users/{id}",
 		AuthType: "bearer",
+		Scopes:   []string{"users:write"},
+		Roles:    []string{"admin"},
 	}, httpserver.HandlerFunc(userHandler.DeleteUser))
 
 	logger.Info("User Service started on port 8080")
 	logger.Info("Health check: GET /health")
 	logger.Info("API endpoints: GET/POST/PUT/DELETE /users")
 
-	// Start server
-	if err := server.Start(); err != nil {
-		logger.Error("Server failed to start", zap.Error(err))
+	// Serve until SIGINT or SIGTERM, then drain in-flight requests
+	ctx, stop := httpserver.SignalContext(context.Background())
+	defer stop()
+
+	if err := server.Start(ctx); err != nil {
+		logger.Error("Server stopped with error", zap.Error(err))
 	}
 }
@@ -1,6 +1,20 @@
 package httpserver
 
-import "net/http"
+import (
+	"net/http"
+	"strings"
+)
+
+// Built-in auth types for Route.AuthType
+const (
+	AuthNone   = "none"
+	AuthBasic  = "basic"
+	AuthBearer = "bearer"
+	AuthAPIKey = "api-key"
+)
+
+// defaultAPIKeyHeader is the header read by NewAPIKeyAuthenticator when none is given
+const defaultAPIKeyHeader = "X-API-Key"
 
 // RequestAuth contains authentication information for a request
 type RequestAuth struct {
@@ -10,4 +24,125 @@ type RequestAuth struct {
 }
 
 // AuthCallback is the function signature for authentication checking
-type AuthCallback func(r *http.Request) (bool, RequestAuth)
\ No newline at end of file
+type AuthCallback func(r *http.Request) (bool, RequestAuth)
+
+// Authenticate calls the callback, so an AuthCallback is also an Authenticator
+func (f AuthCallback) Authenticate(r *http.Request) (bool, RequestAuth) {
+	return f(r)
+}
+
+// Authenticator checks the credentials of a request for one auth type. It
+// reports false if the request carries no credentials it understands or
+// they are invalid.
+type Authenticator interface {
+	Authenticate(r *http.Request) (bool, RequestAuth)
+}
+
+// CredentialDetector is implemented by authenticators that read credentials
+// from somewhere other than the Authorization header, so routes that also
+// allow "none" can reject invalid credentials instead of treating the request
+// as anonymous. Any Authorization header counts as credentials.
+type CredentialDetector interface {
+	HasCredentials(r *http.Request) bool
+}
+
+// apiKeyAuthenticator is the Authenticator returned by NewAPIKeyAuthenticator
+type apiKeyAuthenticator struct {
+	header       string
+	authenticate AuthCallback
+}
+
+func (a apiKeyAuthenticator) Authenticate(r *http.Request) (bool, RequestAuth) {
+	return a.authenticate(r)
+}
+
+// HasCredentials reports whether the API key header is set
+func (a apiKeyAuthenticator) HasCredentials(r *http.Request) bool {
+	return r.Header.Get(a.header) != ""
+}
+
+// hasCredentials reports whether r carries credentials for authenticator
+func hasCredentials(authenticator Authenticator, r *http.Request) bool {
+	if r.Header.Get("Authorization") != "" {
+		return true
+	}
+	detector, ok := authenticator.(CredentialDetector)
+	return ok && detector.HasCredentials(r)
+}
+
+// NewBasicAuthenticator parses "Authorization: Basic" credentials and passes
+// them to validate. Type defaults to "basic" and Client to the username.
+func NewBasicAuthenticator(validate func(username, password string) (bool, RequestAuth)) Authenticator {
+	return AuthCallback(func(r *http.Request) (bool, RequestAuth) {
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			return false, RequestAuth{}
+		}
+
+		valid, auth := validate(username, password)
+		if !valid {
+			return false, RequestAuth{}
+		}
+		if auth.Type == "" {
+			auth.Type = AuthBasic
+		}
+		if auth.Client == "" {
+			auth.Client = username
+		}
+		return true, auth
+	})
+}
+
+// NewBearerAuthenticator parses "Authorization: Bearer" tokens and passes
+// them to validate. Type defaults to "bearer".
+func NewBearerAuthenticator(validate func(token string) (bool, RequestAuth)) Authenticator {
+	return AuthCallback(func(r *http.Request) (bool, RequestAuth) {
+		token, ok := BearerToken(r)
+		if !ok {
+			return false, RequestAuth{}
+		}
+
+		valid, auth := validate(token)
+		if !valid {
+			return false, RequestAuth{}
+		}
+		if auth.Type == "" {
+			auth.Type = AuthBearer
+		}
+		return true, auth
+	})
+}
+
+// NewAPIKeyAuthenticator reads an API key from header (default "X-API-Key")
+// and passes it to validate. Type defaults to "api-key".
+func NewAPIKeyAuthenticator(header string, validate func(key string) (bool, RequestAuth)) Authenticator {
+	if header == "" {
+		header = defaultAPIKeyHeader
+	}
+	authenticate := func(r *http.Request) (bool, RequestAuth) {
+		key := r.Header.Get(header)
+		if key == "" {
+			return false, RequestAuth{}
+		}
+
+		valid, auth := validate(key)
+		if !valid {
+			return false, RequestAuth{}
+		}
+		if auth.Type == "" {
+			auth.Type = AuthAPIKey
+		}
+		return true, auth
+	}
+	return apiKeyAuthenticator{header: header, authenticate: authenticate}
+}
+
+// BearerToken extracts the token from an "Authorization: Bearer" header
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
@@ -0,0 +1,74 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/umakantv/go-utils/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init(logger.LoggerConfig{})
+	os.Exit(m.Run())
+}
+
+// serve sends req through the server's router
+func serve(s *Server, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestOptionalAuthentication(t *testing.T) {
+	s := New("0", nil)
+	s.RegisterAuthenticator(AuthBearer, NewBearerAuthenticator(func(token string) (bool, RequestAuth) {
+		return token == "valid", RequestAuth{Client: "bearer-client"}
+	}))
+	s.RegisterAuthenticator(AuthAPIKey, NewAPIKeyAuthenticator("", func(key string) (bool, RequestAuth) {
+		return key == "valid", RequestAuth{Client: "key-client"}
+	}))
+	s.Register(Route{Name: "Optional", Method: http.MethodGet, Path: "/optional", AuthTypes: []string{AuthBearer, AuthAPIKey, AuthNone}},
+		HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			client := "anonymous"
+			if auth := GetRequestAuth(ctx); auth != nil {
+				client = auth.Client
+			}
+			w.Write([]byte(client))
+		}))
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		status int
+		client string
+	}{
+		{"no credentials", "", "", http.StatusOK, "anonymous"},
+		{"valid bearer", "Authorization", "Bearer valid", http.StatusOK, "bearer-client"},
+		{"valid api key", "X-API-Key", "valid", http.StatusOK, "key-client"},
+		{"invalid bearer", "Authorization", "Bearer expired", http.StatusUnauthorized, ""},
+		{"invalid api key", "X-API-Key", "revoked", http.StatusUnauthorized, ""},
+		{"unsupported scheme", "Authorization", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/optional", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := serve(s, req)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get("Content-Type") != "application/json" {
+				t.Errorf("401 Content-Type = %q, want application/json", rec.Header().Get("Content-Type"))
+			}
+			if tt.client != "" && rec.Body.String() != tt.client {
+				t.Errorf("client = %q, want %q", rec.Body.String(), tt.client)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/umakantv/go-utils/errs"
+)
+
+// Policy decides whether an authenticated request may proceed. Returning an
+// *errs.AppError sends it as the response; any other error is sent as a 403
+// with the error's message.
+type Policy func(ctx context.Context, r *http.Request, auth RequestAuth) error
+
+// ScopeClaims are claims that can report their OAuth scopes
+type ScopeClaims interface {
+	HasScope(scope string) bool
+}
+
+// RoleClaims are claims that can report their roles
+type RoleClaims interface {
+	HasRole(role string) bool
+}
+
+// SetPolicy sets a policy evaluated for every authenticated request, before
+// the route's own Policy. It may be called while the server is running; each
+// request uses the policy set when it arrives.
+func (s *Server) SetPolicy(policy Policy) {
+	s.policyMutex.Lock()
+	defer s.policyMutex.Unlock()
+
+	s.policy = policy
+}
+
+// serverPolicy returns the policy set with SetPolicy, if any
+func (s *Server) serverPolicy() Policy {
+	s.policyMutex.RLock()
+	defer s.policyMutex.RUnlock()
+
+	return s.policy
+}
+
+// authorize returns a handler that checks the route's scopes, roles and
+// policies against the RequestAuth set by authenticate. Routes without any
+// requirements pass anonymous requests straight through.
+func (s *Server) authorize(route Route, next Handler) Handler {
+	required := len(route.Scopes) > 0 || len(route.Roles) > 0 || route.Policy != nil
+
+	return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		auth := GetRequestAuth(ctx)
+		if auth == nil {
+			if required {
+				writeError(w, errs.NewAuthenticationError("Unauthorized"))
+				return
+			}
+			next.Handle(ctx, w, r)
+			return
+		}
+
+		for _, scope := range route.Scopes {
+			if !hasScope(auth.Claims, scope) {
+				writeError(w, errs.NewAuthorizationError("Missing required scope: "+scope))
+				return
+			}
+		}
+
+		if len(route.Roles) > 0 && !hasAnyRole(auth.Claims, route.Roles) {
+			writeError(w, errs.NewAuthorizationError("Missing required role: one of "+strings.Join(route.Roles, ", ")))
+			return
+		}
+
+		for _, policy := range []Policy{s.serverPolicy(), route.Policy} {
+			if policy == nil {
+				continue
+			}
+			if err := policy(ctx, r, *auth); err != nil {
+				writePolicyError(w, err)
+				return
+			}
+		}
+
+		next.Handle(ctx, w, r)
+	})
+}
+
+// hasScope reports whether claims grant scope. Besides ScopeClaims, claim
+// maps with a "scope" or "scp" entry are understood.
+func hasScope(claims interface{}, scope string) bool {
+	switch claims := claims.(type) {
+	case ScopeClaims:
+		return claims.HasScope(scope)
+	case map[string]interface{}:
+		return claimContains(claims["scope"], scope) || claimContains(claims["scp"], scope)
+	}
+	return false
+}
+
+// hasAnyRole reports whether claims hold at least one of roles. Besides
+// RoleClaims, claim maps with a "roles" entry are understood.
+func hasAnyRole(claims interface{}, roles []string) bool {
+	for _, role := range roles {
+		switch claims := claims.(type) {
+		case RoleClaims:
+			if claims.HasRole(role) {
+				return true
+			}
+		case map[string]interface{}:
+			if claimContains(claims["roles"], role) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// claimContains reports whether a claim value lists want. The value may be
+// a space-separated string or a list of strings.
+func claimContains(value interface{}, want string) bool {
+	switch value := value.(type) {
+	case string:
+		for _, field := range strings.Fields(value) {
+			if field == want {
+				return true
+			}
+		}
+	case []string:
+		for _, item := range value {
+			if item == want {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			if item == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writePolicyError sends a policy's error, as a 403 unless it is an *errs.AppError
+func writePolicyError(w http.ResponseWriter, err error) {
+	var appErr *errs.AppError
+	if errors.As(err, &appErr) && appErr.Code != 0 {
+		writeError(w, appErr)
+		return
+	}
+	writeError(w, errs.NewAuthorizationError(err.Error()))
+}
@@ -0,0 +1,64 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/umakantv/go-utils/errs"
+)
+
+func TestAuthorize(t *testing.T) {
+	s := New("0", nil)
+	s.RegisterAuthenticator(AuthBearer, NewBearerAuthenticator(func(token string) (bool, RequestAuth) {
+		return token == "valid", RequestAuth{Client: "tenant-a", Claims: &JWTClaims{Scope: "orders:read"}}
+	}))
+	ok := HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	s.Register(Route{Name: "Orders", Method: http.MethodGet, Path: "/orders", AuthTypes: []string{AuthBearer, AuthNone}, Scopes: []string{"orders:read"}}, ok)
+	s.Register(Route{Name: "Refunds", Method: http.MethodGet, Path: "/refunds", AuthTypes: []string{AuthBearer}, Scopes: []string{"refunds:write"}}, ok)
+
+	request := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return serve(s, req)
+	}
+
+	rec := request("/orders", "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	var body errs.AppError
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous body = %q, want a JSON 401 error", rec.Body.String())
+	}
+
+	if rec := request("/orders", "valid"); rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec := request("/refunds", "valid"); rec.Code != http.StatusForbidden {
+		t.Errorf("missing scope status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	// A policy set after routes are registered and served applies to the next request
+	s.SetPolicy(func(ctx context.Context, r *http.Request, auth RequestAuth) error {
+		if auth.Client == "tenant-a" {
+			return errors.New("tenant is blocked")
+		}
+		return nil
+	})
+	if rec := request("/orders", "valid"); rec.Code != http.StatusForbidden {
+		t.Errorf("blocked status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	s.SetPolicy(nil)
+	if rec := request("/orders", "valid"); rec.Code != http.StatusOK {
+		t.Errorf("unblocked status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
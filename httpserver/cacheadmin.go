@@ -0,0 +1,195 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/umakantv/go-utils/cache"
+	"github.com/umakantv/go-utils/errs"
+)
+
+// defaultAdminKeyLimit caps the keys listed by one request unless the limit parameter is set
+const defaultAdminKeyLimit = 1000
+
+// CacheAdmin exposes a cache over HTTP for debugging: listing keys, reading
+// values and TTLs, changing TTLs, deleting keys and reading stats
+type CacheAdmin struct {
+	cache cache.Cache
+}
+
+// keysResponse is the body of a key listing
+type keysResponse struct {
+	Keys      []string `json:"keys"`
+	Truncated bool     `json:"truncated"` // more keys match than the limit
+}
+
+// keyResponse is the body of a key lookup
+type keyResponse struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+	TTL   string      `json:"ttl,omitempty"` // remaining lifetime, omitted if the key never expires
+}
+
+// NewCacheAdmin creates an admin handler for c
+func NewCacheAdmin(c cache.Cache) *CacheAdmin {
+	return &CacheAdmin{cache: c}
+}
+
+// Register adds the admin routes under prefix, e.g. "/admin/cache":
+//
+//	GET    {prefix}/keys?pattern=user:*&limit=100
+//	GET    {prefix}/key?key=user:42
+//	DELETE {prefix}/key?key=user:42
+//	PUT    {prefix}/key/ttl?key=user:42&ttl=10m   (ttl=0 removes the expiry)
+//	GET    {prefix}/stats
+//
+// Every route copies the auth types, scopes, roles, policy and middleware of
+// template, e.g. Route{AuthType: "bearer", Roles: []string{"admin"}}. The
+// routes expose and modify cached data, so template must not allow "none".
+func (a *CacheAdmin) Register(server *Server, prefix string, template Route) error {
+	authTypes := template.authTypes()
+	if len(authTypes) == 0 {
+		return errors.New("httpserver: cache admin routes require authentication")
+	}
+	for _, authType := range authTypes {
+		if authType == "" || authType == AuthNone {
+			return errors.New("httpserver: cache admin routes require authentication")
+		}
+	}
+
+	routes := []struct {
+		name    string
+		method  string
+		path    string
+		handler HandlerFunc
+	}{
+		{"CacheAdminKeys", http.MethodGet, "/keys", a.keys},
+		{"CacheAdminGetKey", http.MethodGet, "/key", a.getKey},
+		{"CacheAdminDeleteKey", http.MethodDelete, "/key", a.deleteKey},
+		{"CacheAdminExpire", http.MethodPut, "/key/ttl", a.expire},
+		{"CacheAdminStats", http.MethodGet, "/stats", a.stats},
+	}
+	for _, r := range routes {
+		route := template
+		route.Name, route.Method, route.Path = r.name, r.method, prefix+r.path
+		server.Register(route, r.handler)
+	}
+	return nil
+}
+
+// keys lists the keys matching the pattern parameter, up to limit
+func (a *CacheAdmin) keys(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	limit := defaultAdminKeyLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			writeError(w, errs.NewValidationError("limit must be a positive integer"))
+			return
+		}
+		limit = parsed
+	}
+
+	response := keysResponse{Keys: []string{}}
+	err := a.cache.Scan(ctx, r.URL.Query().Get("pattern"), func(key string) bool {
+		if len(response.Keys) == limit {
+			response.Truncated = true
+			return false
+		}
+		response.Keys = append(response.Keys, key)
+		return true
+	})
+	if err != nil {
+		writeError(w, errs.NewInternalServerError(err.Error()))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// getKey returns the value and TTL of the key parameter. It peeks, so
+// inspecting a key does not skew hit/miss stats or eviction order.
+func (a *CacheAdmin) getKey(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	key, ok := requireKey(w, r)
+	if !ok {
+		return
+	}
+
+	value, ttl, err := a.cache.Peek(ctx, key)
+	if err != nil {
+		writeCacheError(w, err)
+		return
+	}
+
+	response := keyResponse{Key: key, Value: value}
+	if ttl > 0 {
+		response.TTL = ttl.Round(time.Millisecond).String()
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// deleteKey removes the key parameter
+func (a *CacheAdmin) deleteKey(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	key, ok := requireKey(w, r)
+	if !ok {
+		return
+	}
+
+	if err := a.cache.DeleteCtx(ctx, key); err != nil {
+		writeCacheError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// expire sets the TTL of the key parameter to the ttl parameter
+func (a *CacheAdmin) expire(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	key, ok := requireKey(w, r)
+	if !ok {
+		return
+	}
+
+	ttl, err := time.ParseDuration(r.URL.Query().Get("ttl"))
+	if err != nil {
+		writeError(w, errs.NewValidationError("ttl must be a duration such as 30s or 10m"))
+		return
+	}
+
+	if err := a.cache.Expire(ctx, key, ttl); err != nil {
+		writeCacheError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// stats returns the cache counters
+func (a *CacheAdmin) stats(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	stats, err := a.cache.Stats(ctx)
+	if err != nil {
+		writeCacheError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// requireKey reads the key parameter, answering with a validation error if it is missing
+func requireKey(w http.ResponseWriter, r *http.Request) (string, bool) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		writeError(w, errs.NewValidationError("key is required"))
+		return "", false
+	}
+	return key, true
+}
+
+// writeCacheError maps a cache error to an error response
+func writeCacheError(w http.ResponseWriter, err error) {
+	if errors.Is(err, cache.ErrKeyNotFound) {
+		writeError(w, errs.NewNotFoundError("Key not found"))
+		return
+	}
+	writeError(w, errs.NewInternalServerError(fmt.Sprintf("Cache error: %v", err)))
+}
@@ -0,0 +1,266 @@
+package httpserver
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/umakantv/go-utils/httpclient"
+	"github.com/umakantv/go-utils/logger"
+	"go.uber.org/zap"
+)
+
+// defaultJWKSTTL is used when JWTConfig.JWKSTTL is not set
+const defaultJWKSTTL = time.Hour
+
+// defaultJWKSTimeout bounds JWKS requests when JWTConfig.HTTPClient is not set
+const defaultJWKSTimeout = 10 * time.Second
+
+// jwksMinRefreshInterval limits how often unknown key IDs or failed fetches
+// cause the key set to be requested again
+const jwksMinRefreshInterval = 30 * time.Second
+
+// jwks caches the keys of a JSON Web Key Set, refetching them when they
+// expire or a token names a key that is not in the set. Fetches run without
+// the lock held, and concurrent callers share a single fetch.
+type jwks struct {
+	url    string
+	client *httpclient.Client
+	ttl    time.Duration
+	now    func() time.Time
+
+	// mutex guards the fields below
+	mutex     sync.Mutex
+	keys      []jwksKey
+	fetchedAt time.Time  // last successful fetch
+	checkedAt time.Time  // last fetch attempt
+	fetching  *jwksFetch // fetch in flight, if any
+}
+
+// jwksFetch is an in-flight fetch of the key set
+type jwksFetch struct {
+	done     chan struct{}
+	replaced bool // the fetch succeeded and replaced the keys
+}
+
+// jwksKey is a verification key from the set
+type jwksKey struct {
+	kid string
+	alg string // algorithm the key is restricted to, if any
+	key crypto.PublicKey
+}
+
+// jsonWebKey is a key as published in a key set
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// newJWKS creates a key set cache for config.JWKSURL
+func newJWKS(config JWTConfig) *jwks {
+	client := config.HTTPClient
+	if client == nil {
+		client = httpclient.New(httpclient.ClientConfig{Timeout: defaultJWKSTimeout})
+	}
+	ttl := config.JWKSTTL
+	if ttl <= 0 {
+		ttl = defaultJWKSTTL
+	}
+	return &jwks{
+		url:    config.JWKSURL,
+		client: client,
+		ttl:    ttl,
+		now:    config.Now,
+	}
+}
+
+// key returns the key with the given ID for alg. Without an ID, the only
+// key usable with alg is returned. Once the set is older than its TTL, cached
+// keys keep being served while it is refetched in the background.
+func (k *jwks) key(kid, alg string) (crypto.PublicKey, error) {
+	k.mutex.Lock()
+	key, found := k.find(kid, alg)
+	expired := k.now().Sub(k.fetchedAt) >= k.ttl
+	k.mutex.Unlock()
+
+	if found {
+		if expired {
+			k.startFetch()
+		}
+		return key, nil
+	}
+
+	// The provider may have rotated in a new key since the last fetch
+	if k.refresh() {
+		k.mutex.Lock()
+		key, found = k.find(kid, alg)
+		k.mutex.Unlock()
+		if found {
+			return key, nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+// find looks a key up in the cached set. Callers must hold the mutex.
+func (k *jwks) find(kid, alg string) (crypto.PublicKey, bool) {
+	var found crypto.PublicKey
+	for _, candidate := range k.keys {
+		if candidate.alg != "" && candidate.alg != alg {
+			continue
+		}
+		if keyAlg, _ := publicKeyAlgorithm(candidate.key); keyAlg != alg {
+			continue
+		}
+		if kid != "" {
+			if candidate.kid == kid {
+				return candidate.key, true
+			}
+			continue
+		}
+		if found != nil {
+			return nil, false // ambiguous without a key ID
+		}
+		found = candidate.key
+	}
+	return found, found != nil
+}
+
+// refresh waits for a fetch of the key set, joining the one in flight if
+// any, and reports whether the keys were replaced. It returns false at once
+// if a fetch was attempted recently. On failure the previous keys are kept.
+func (k *jwks) refresh() bool {
+	fetch := k.startFetch()
+	if fetch == nil {
+		return false
+	}
+	<-fetch.done
+	return fetch.replaced
+}
+
+// startFetch returns the fetch in flight, starting one in the background
+// unless the last attempt was within jwksMinRefreshInterval
+func (k *jwks) startFetch() *jwksFetch {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if k.fetching != nil {
+		return k.fetching
+	}
+	now := k.now()
+	if !k.checkedAt.IsZero() && now.Sub(k.checkedAt) < jwksMinRefreshInterval {
+		return nil
+	}
+	k.checkedAt = now
+
+	fetch := &jwksFetch{done: make(chan struct{})}
+	k.fetching = fetch
+	go k.run(fetch)
+	return fetch
+}
+
+// run performs a fetch and stores its keys
+func (k *jwks) run(fetch *jwksFetch) {
+	keys, err := k.fetch()
+	if err != nil {
+		logger.Error("Failed to fetch JWKS", zap.String("url", k.url), zap.Error(err))
+	}
+
+	k.mutex.Lock()
+	if err == nil {
+		k.keys = keys
+		k.fetchedAt = k.now()
+		fetch.replaced = true
+	}
+	k.fetching = nil
+	k.mutex.Unlock()
+	close(fetch.done)
+}
+
+// fetch requests and parses the key set, skipping keys that cannot verify
+// RS256 or ES256 signatures
+func (k *jwks) fetch() ([]jwksKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := k.client.GetJSON(k.url, &set); err != nil {
+		return nil, err
+	}
+
+	var keys []jwksKey
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			logger.Debug("Skipping JWKS key", zap.String("kid", jwk.Kid), zap.Error(err))
+			continue
+		}
+		keys = append(keys, jwksKey{kid: jwk.Kid, alg: jwk.Alg, key: key})
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no usable signing keys")
+	}
+	return keys, nil
+}
+
+// publicKey decodes an RSA or P-256 EC key
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 2 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		curve := elliptic.P256()
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+// decodeBigInt decodes a base64url big-endian integer
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,464 @@
+package httpserver
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/umakantv/go-utils/httpclient"
+	"github.com/umakantv/go-utils/logger"
+	"go.uber.org/zap"
+)
+
+// Supported JWT signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+)
+
+// JWT verification errors
+var (
+	ErrInvalidToken     = errors.New("httpserver: invalid token")
+	ErrInvalidSignature = errors.New("httpserver: invalid token signature")
+	ErrUnknownKey       = errors.New("httpserver: unknown token signing key")
+	ErrTokenExpired     = errors.New("httpserver: token expired")
+	ErrTokenNotYetValid = errors.New("httpserver: token not yet valid")
+	ErrInvalidIssuer    = errors.New("httpserver: invalid token issuer")
+	ErrInvalidAudience  = errors.New("httpserver: invalid token audience")
+)
+
+// JWTConfig holds JWT authenticator configuration. At least one of Secret,
+// PublicKey and JWKSURL must be set.
+type JWTConfig struct {
+	Secret     []byte             // HMAC secret for HS256 tokens
+	PublicKey  crypto.PublicKey   // *rsa.PublicKey or P-256 *ecdsa.PublicKey for tokens without a JWKS
+	JWKSURL    string             // JSON Web Key Set URL for RS256 and ES256 tokens
+	JWKSTTL    time.Duration      // How long fetched keys are cached (default 1h)
+	HTTPClient *httpclient.Client // Client used to fetch the JWKS (default 10s timeout)
+	Algorithms []string           // Accepted algorithms (default every algorithm a key is configured for)
+	Issuer     string             // Required "iss" claim, if set
+	Audience   string             // Required "aud" entry, if set
+	Leeway     time.Duration      // Allowed clock skew when checking exp and nbf
+	Now        func() time.Time   // Time source (default time.Now)
+}
+
+// JWTClaims are the claims of a verified token
+type JWTClaims struct {
+	Issuer    string      `json:"iss,omitempty"`
+	Subject   string      `json:"sub,omitempty"`
+	Audience  Audience    `json:"aud,omitempty"`
+	ExpiresAt NumericDate `json:"exp,omitempty"`
+	NotBefore NumericDate `json:"nbf,omitempty"`
+	IssuedAt  NumericDate `json:"iat,omitempty"`
+	ID        string      `json:"jti,omitempty"`
+	ClientID  string      `json:"client_id,omitempty"` // Numeric IDs are kept as text
+	Scope     string      `json:"scope,omitempty"`     // Space-separated OAuth scopes; a list is joined with spaces
+
+	// Raw holds every claim of the token by name, including custom ones
+	Raw map[string]interface{} `json:"-"`
+}
+
+// UnmarshalJSON decodes the registered claims and fills Raw. Providers
+// disagree on the shape of client_id and scope, so those are read leniently
+// instead of failing the token.
+func (c *JWTClaims) UnmarshalJSON(data []byte) error {
+	// The outer fields take precedence over the embedded ones of the same name
+	type registeredClaims JWTClaims
+	var claims struct {
+		registeredClaims
+		ClientID json.RawMessage `json:"client_id"`
+		Scope    interface{}     `json:"scope"`
+	}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*c = JWTClaims(claims.registeredClaims)
+	c.ClientID = claimText(claims.ClientID)
+	c.Scope = strings.Join(claimList(claims.Scope), " ")
+	c.Raw = raw
+	return nil
+}
+
+// HasScope reports whether the token grants scope, from its "scope" or "scp" claim
+func (c *JWTClaims) HasScope(scope string) bool {
+	return claimContains(c.Scope, scope) || claimContains(c.Raw["scp"], scope)
+}
+
+// HasRole reports whether the token's "roles" claim lists role
+func (c *JWTClaims) HasRole(role string) bool {
+	return claimContains(c.Raw["roles"], role)
+}
+
+// claimText returns a string or number claim as text, or "" for any other value
+func claimText(value json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(value, &text); err == nil {
+		return text
+	}
+	var number json.Number
+	if err := json.Unmarshal(value, &number); err == nil {
+		return number.String()
+	}
+	return ""
+}
+
+// claimList returns the strings of a space-separated string claim or a list
+// claim, skipping anything else
+func claimList(value interface{}) []string {
+	switch value := value.(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		var items []string
+		for _, item := range value {
+			if text, ok := item.(string); ok {
+				items = append(items, text)
+			}
+		}
+		return items
+	}
+	return nil
+}
+
+// Audience is the "aud" claim, which may be a single string or a list
+type Audience []string
+
+// UnmarshalJSON accepts a string or an array of strings
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// MarshalJSON writes a single audience as a string
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// Contains reports whether audience is listed
+func (a Audience) Contains(audience string) bool {
+	for _, candidate := range a {
+		if candidate == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// NumericDate is a JWT time claim in seconds since the Unix epoch
+type NumericDate int64
+
+// NewNumericDate converts t to a NumericDate
+func NewNumericDate(t time.Time) NumericDate {
+	return NumericDate(t.Unix())
+}
+
+// UnmarshalJSON accepts integer and fractional seconds
+func (d *NumericDate) UnmarshalJSON(data []byte) error {
+	seconds, err := strconv.ParseFloat(string(data), 64)
+	if err != nil {
+		return fmt.Errorf("invalid numeric date %s", data)
+	}
+	*d = NumericDate(seconds)
+	return nil
+}
+
+// Time returns the date as a time.Time
+func (d NumericDate) Time() time.Time {
+	return time.Unix(int64(d), 0)
+}
+
+// jwtHeader is the JOSE header of a token
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// JWTAuthenticator authenticates "Authorization: Bearer" JSON Web Tokens,
+// setting RequestAuth.Claims to the token's *JWTClaims and Client to its
+// client_id or, failing that, its subject
+type JWTAuthenticator struct {
+	config     JWTConfig
+	algorithms map[string]bool
+	jwks       *jwks
+}
+
+// NewJWTAuthenticator creates a JWT authenticator. JWKS keys are fetched on
+// first use, so the identity provider need not be reachable at startup.
+func NewJWTAuthenticator(config JWTConfig) (*JWTAuthenticator, error) {
+	if len(config.Secret) == 0 && config.PublicKey == nil && config.JWKSURL == "" {
+		return nil, errors.New("httpserver: JWT authenticator requires a secret, public key or JWKS URL")
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+
+	a := &JWTAuthenticator{config: config, algorithms: make(map[string]bool)}
+	if config.JWKSURL != "" {
+		a.jwks = newJWKS(config)
+	}
+
+	// Only accept algorithms a key is configured for, so an RSA public key
+	// can never be used as an HMAC secret
+	available := make(map[string]bool)
+	if len(config.Secret) > 0 {
+		available[AlgHS256] = true
+	}
+	if config.PublicKey != nil {
+		alg, err := publicKeyAlgorithm(config.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		available[alg] = true
+	}
+	if a.jwks != nil {
+		available[AlgRS256] = true
+		available[AlgES256] = true
+	}
+
+	if len(config.Algorithms) == 0 {
+		a.algorithms = available
+		return a, nil
+	}
+	for _, alg := range config.Algorithms {
+		if !available[alg] {
+			return nil, fmt.Errorf("httpserver: no key configured for JWT algorithm %q", alg)
+		}
+		a.algorithms[alg] = true
+	}
+	return a, nil
+}
+
+// Authenticate verifies the request's bearer token
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (bool, RequestAuth) {
+	token, ok := BearerToken(r)
+	if !ok {
+		return false, RequestAuth{}
+	}
+
+	claims, err := a.Verify(token)
+	if err != nil {
+		logger.Debug("JWT rejected", zap.Error(err))
+		return false, RequestAuth{}
+	}
+
+	client := claims.ClientID
+	if client == "" {
+		client = claims.Subject
+	}
+	return true, RequestAuth{Type: AuthBearer, Client: client, Claims: claims}
+}
+
+// Verify checks the token's signature and its exp, nbf, iss and aud claims
+func (a *JWTAuthenticator) Verify(token string) (*JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrInvalidToken)
+	}
+	if !a.algorithms[header.Alg] {
+		return nil, fmt.Errorf("%w: algorithm %q not accepted", ErrInvalidToken, header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+	if err := a.verifySignature(header, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	claims := &JWTClaims{}
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims", ErrInvalidToken)
+	}
+
+	if err := a.validateClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// verifySignature checks signature over signed with the key for the header
+func (a *JWTAuthenticator) verifySignature(header jwtHeader, signed string, signature []byte) error {
+	if header.Alg == AlgHS256 {
+		mac := hmac.New(sha256.New, a.config.Secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+
+	key, err := a.publicKey(header)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256([]byte(signed))
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return ErrInvalidSignature
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if len(signature) != 64 {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(key, digest[:], r, s) {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+	return ErrUnknownKey
+}
+
+// publicKey returns the key that signed a token, preferring the JWKS when
+// the token names a key ID
+func (a *JWTAuthenticator) publicKey(header jwtHeader) (crypto.PublicKey, error) {
+	if a.jwks != nil && (header.Kid != "" || a.config.PublicKey == nil) {
+		return a.jwks.key(header.Kid, header.Alg)
+	}
+	if a.config.PublicKey != nil {
+		if alg, _ := publicKeyAlgorithm(a.config.PublicKey); alg == header.Alg {
+			return a.config.PublicKey, nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+// validateClaims checks the time, issuer and audience claims
+func (a *JWTAuthenticator) validateClaims(claims *JWTClaims) error {
+	now := a.config.Now()
+
+	if claims.ExpiresAt == 0 {
+		return fmt.Errorf("%w: missing exp claim", ErrInvalidToken)
+	}
+	if !now.Before(claims.ExpiresAt.Time().Add(a.config.Leeway)) {
+		return ErrTokenExpired
+	}
+	if claims.NotBefore != 0 && now.Add(a.config.Leeway).Before(claims.NotBefore.Time()) {
+		return ErrTokenNotYetValid
+	}
+	if a.config.Issuer != "" && claims.Issuer != a.config.Issuer {
+		return ErrInvalidIssuer
+	}
+	if a.config.Audience != "" && !claims.Audience.Contains(a.config.Audience) {
+		return ErrInvalidAudience
+	}
+	return nil
+}
+
+// SignJWT encodes claims as a token signed with key: a []byte secret signs
+// with HS256, an *rsa.PrivateKey with RS256 and a P-256 *ecdsa.PrivateKey
+// with ES256. kid is written to the header if set.
+func SignJWT(claims interface{}, key interface{}, kid string) (string, error) {
+	header := jwtHeader{Typ: "JWT", Kid: kid}
+	switch key := key.(type) {
+	case []byte:
+		header.Alg = AlgHS256
+	case *rsa.PrivateKey:
+		header.Alg = AlgRS256
+	case *ecdsa.PrivateKey:
+		if key.Curve != elliptic.P256() {
+			return "", errors.New("httpserver: ES256 requires a P-256 key")
+		}
+		header.Alg = AlgES256
+	default:
+		return "", fmt.Errorf("httpserver: unsupported JWT signing key %T", key)
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	var signature []byte
+	digest := sha256.Sum256([]byte(signed))
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			return "", err
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			return "", err
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// publicKeyAlgorithm returns the algorithm a public key verifies
+func publicKeyAlgorithm(key crypto.PublicKey) (string, error) {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return AlgRS256, nil
+	case *ecdsa.PublicKey:
+		if key.Curve == elliptic.P256() {
+			return AlgES256, nil
+		}
+	}
+	return "", fmt.Errorf("httpserver: unsupported JWT public key %T", key)
+}
+
+// decodeSegment decodes a base64url JSON token segment into v
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,410 @@
+package httpserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// jwksStandIn serves a JSON Web Key Set that tests can swap out, counting
+// the requests it answers
+type jwksStandIn struct {
+	server *httptest.Server
+
+	mutex    sync.Mutex
+	keys     []map[string]string
+	requests int
+	release  chan struct{} // while set, requests wait for it to close
+}
+
+// newJWKSStandIn starts a key set server that stops when the test ends
+func newJWKSStandIn(t *testing.T, keys ...map[string]string) *jwksStandIn {
+	t.Helper()
+	s := &jwksStandIn{keys: keys}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.Lock()
+		s.requests++
+		release := s.release
+		keys := s.keys
+		s.mutex.Unlock()
+
+		if release != nil {
+			<-release
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"keys": keys})
+	}))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// setKeys replaces the published keys
+func (s *jwksStandIn) setKeys(keys ...map[string]string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.keys = keys
+}
+
+// hold makes requests wait until the returned function is called
+func (s *jwksStandIn) hold() func() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	release := make(chan struct{})
+	s.release = release
+	return func() {
+		s.mutex.Lock()
+		s.release = nil
+		s.mutex.Unlock()
+		close(release)
+	}
+}
+
+// requestCount returns the number of key set requests so far
+func (s *jwksStandIn) requestCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.requests
+}
+
+// rsaJWK publishes an RSA public key
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"alg": AlgRS256,
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// ecJWK publishes a P-256 public key
+func ecJWK(kid string, key *ecdsa.PublicKey) map[string]string {
+	x, y := make([]byte, 32), make([]byte, 32)
+	key.X.FillBytes(x)
+	key.Y.FillBytes(y)
+	return map[string]string{
+		"kty": "EC",
+		"kid": kid,
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(x),
+		"y":   base64.RawURLEncoding.EncodeToString(y),
+	}
+}
+
+// testClock is an adjustable time source for JWTConfig.Now
+type testClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newECKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// sign signs claims expiring an hour after clock's time
+func sign(t *testing.T, clock *testClock, subject string, key interface{}, kid string) string {
+	t.Helper()
+	claims := JWTClaims{Subject: subject, ExpiresAt: NewNumericDate(clock.Now().Add(time.Hour))}
+	token, err := SignJWT(claims, key, kid)
+	if err != nil {
+		t.Fatalf("SignJWT: %v", err)
+	}
+	return token
+}
+
+func TestJWTAlgorithms(t *testing.T) {
+	clock := &testClock{now: time.Now()}
+	rsaKey, ecKey, secret := newRSAKey(t), newECKey(t), []byte("test-secret")
+	jwks := newJWKSStandIn(t, rsaJWK("rsa-1", &rsaKey.PublicKey), ecJWK("ec-1", &ecKey.PublicKey))
+
+	a, err := NewJWTAuthenticator(JWTConfig{Secret: secret, JWKSURL: jwks.server.URL, Now: clock.Now})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		key  interface{}
+		kid  string
+	}{
+		{"RS256", rsaKey, "rsa-1"},
+		{"ES256", ecKey, "ec-1"},
+		{"ES256 without kid", ecKey, ""},
+		{"HS256", secret, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := a.Verify(sign(t, clock, tt.name, tt.key, tt.kid))
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if claims.Subject != tt.name {
+				t.Errorf("Subject = %q, want %q", claims.Subject, tt.name)
+			}
+		})
+	}
+
+	// A key the set does not publish, under a known kid, fails the signature check
+	if _, err := a.Verify(sign(t, clock, "forged", newRSAKey(t), "rsa-1")); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify(forged RS256) = %v, want ErrInvalidSignature", err)
+	}
+	if _, err := a.Verify(sign(t, clock, "forged", []byte("other-secret"), "")); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify(forged HS256) = %v, want ErrInvalidSignature", err)
+	}
+	if n := jwks.requestCount(); n != 1 {
+		t.Errorf("key set requests = %d, want 1", n)
+	}
+}
+
+func TestJWKSKeyRotation(t *testing.T) {
+	clock := &testClock{now: time.Now()}
+	oldKey, newKey := newRSAKey(t), newRSAKey(t)
+	jwks := newJWKSStandIn(t, rsaJWK("old", &oldKey.PublicKey))
+
+	a, err := NewJWTAuthenticator(JWTConfig{JWKSURL: jwks.server.URL, Now: clock.Now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Verify(sign(t, clock, "user", oldKey, "old")); err != nil {
+		t.Fatalf("Verify(old): %v", err)
+	}
+
+	jwks.setKeys(rsaJWK("old", &oldKey.PublicKey), rsaJWK("new", &newKey.PublicKey))
+
+	// Unknown key IDs refetch the set, but at most once per jwksMinRefreshInterval
+	if _, err := a.Verify(sign(t, clock, "user", newKey, "new")); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Verify(new) right after a fetch = %v, want ErrUnknownKey", err)
+	}
+	clock.Advance(jwksMinRefreshInterval)
+	if _, err := a.Verify(sign(t, clock, "user", newKey, "new")); err != nil {
+		t.Fatalf("Verify(new) after rotation: %v", err)
+	}
+
+	// Once the old key is retired, its tokens are rejected after the next fetch
+	jwks.setKeys(rsaJWK("new", &newKey.PublicKey))
+	clock.Advance(jwksMinRefreshInterval)
+	if _, err := a.Verify(sign(t, clock, "user", newKey, "other")); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Verify(unknown kid) = %v, want ErrUnknownKey", err)
+	}
+	if _, err := a.Verify(sign(t, clock, "user", oldKey, "old")); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Verify(retired key) = %v, want ErrUnknownKey", err)
+	}
+	if n := jwks.requestCount(); n != 3 {
+		t.Errorf("key set requests = %d, want 3", n)
+	}
+}
+
+func TestJWKSSharedFetch(t *testing.T) {
+	clock := &testClock{now: time.Now()}
+	key := newECKey(t)
+	jwks := newJWKSStandIn(t, ecJWK("ec-1", &key.PublicKey))
+	release := jwks.hold()
+
+	a, err := NewJWTAuthenticator(JWTConfig{JWKSURL: jwks.server.URL, Now: clock.Now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := sign(t, clock, "user", key, "ec-1")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := a.Verify(token); err != nil {
+				t.Errorf("Verify: %v", err)
+			}
+		}()
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	release()
+	wg.Wait()
+	if n := jwks.requestCount(); n != 1 {
+		t.Errorf("key set requests = %d, want 1", n)
+	}
+}
+
+func TestJWKSServesCachedKeysWhileRefreshing(t *testing.T) {
+	clock := &testClock{now: time.Now()}
+	key := newRSAKey(t)
+	jwks := newJWKSStandIn(t, rsaJWK("rsa-1", &key.PublicKey))
+
+	a, err := NewJWTAuthenticator(JWTConfig{JWKSURL: jwks.server.URL, JWKSTTL: time.Minute, Now: clock.Now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Verify(sign(t, clock, "user", key, "rsa-1")); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	// The set has expired and its refetch hangs, yet tokens still verify
+	clock.Advance(2 * time.Minute)
+	release := jwks.hold()
+	defer release()
+
+	verified := make(chan error, 1)
+	go func() {
+		_, err := a.Verify(sign(t, clock, "user", key, "rsa-1"))
+		verified <- err
+	}()
+	select {
+	case err := <-verified:
+		if err != nil {
+			t.Fatalf("Verify during refresh: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Verify waited for the key set refresh")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for jwks.requestCount() != 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := jwks.requestCount(); n != 2 {
+		t.Errorf("key set requests = %d, want a background refresh", n)
+	}
+}
+
+func TestJWTClaimChecks(t *testing.T) {
+	clock := &testClock{now: time.Now()}
+	secret := []byte("test-secret")
+	a, err := NewJWTAuthenticator(JWTConfig{
+		Secret:   secret,
+		Issuer:   "https://issuer.example",
+		Audience: "orders",
+		Leeway:   30 * time.Second,
+		Now:      clock.Now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := clock.Now()
+	valid := func() JWTClaims {
+		return JWTClaims{
+			Issuer:    "https://issuer.example",
+			Subject:   "user",
+			Audience:  Audience{"orders"},
+			ExpiresAt: NewNumericDate(now.Add(time.Hour)),
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(c *JWTClaims)
+		want   error
+	}{
+		{"valid", func(c *JWTClaims) {}, nil},
+		{"audience in a list", func(c *JWTClaims) { c.Audience = Audience{"billing", "orders"} }, nil},
+		{"expired", func(c *JWTClaims) { c.ExpiresAt = NewNumericDate(now.Add(-time.Minute)) }, ErrTokenExpired},
+		{"expired within leeway", func(c *JWTClaims) { c.ExpiresAt = NewNumericDate(now.Add(-10 * time.Second)) }, nil},
+		{"missing exp", func(c *JWTClaims) { c.ExpiresAt = 0 }, ErrInvalidToken},
+		{"not yet valid", func(c *JWTClaims) { c.NotBefore = NewNumericDate(now.Add(time.Minute)) }, ErrTokenNotYetValid},
+		{"not yet valid within leeway", func(c *JWTClaims) { c.NotBefore = NewNumericDate(now.Add(10 * time.Second)) }, nil},
+		{"wrong issuer", func(c *JWTClaims) { c.Issuer = "https://evil.example" }, ErrInvalidIssuer},
+		{"wrong audience", func(c *JWTClaims) { c.Audience = Audience{"billing"} }, ErrInvalidAudience},
+		{"missing audience", func(c *JWTClaims) { c.Audience = nil }, ErrInvalidAudience},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+			tt.change(&claims)
+			token, err := SignJWT(claims, secret, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := a.Verify(token); !errors.Is(err, tt.want) {
+				t.Errorf("Verify = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestJWTLenientClaims(t *testing.T) {
+	secret := []byte("test-secret")
+	a, err := NewJWTAuthenticator(JWTConfig{Secret: secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		client string
+		scope  string
+	}{
+		{"string claims", map[string]interface{}{"client_id": "svc", "scope": "read write"}, "svc", "read write"},
+		{"scope list", map[string]interface{}{"client_id": "svc", "scope": []string{"read", "write"}}, "svc", "read write"},
+		{"numeric client_id", map[string]interface{}{"client_id": 1234567890123, "scope": "read"}, "1234567890123", "read"},
+		{"unexpected shapes", map[string]interface{}{"sub": "user", "client_id": true, "scope": 7}, "user", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.claims["exp"] = time.Now().Add(time.Hour).Unix()
+			token, err := SignJWT(tt.claims, secret, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			ok, auth := a.Authenticate(req)
+			if !ok {
+				t.Fatal("Authenticate rejected the token")
+			}
+			claims := auth.Claims.(*JWTClaims)
+			if auth.Client != tt.client || claims.Scope != tt.scope {
+				t.Errorf("client, scope = %q, %q, want %q, %q", auth.Client, claims.Scope, tt.client, tt.scope)
+			}
+			if _, ok := claims.Raw["client_id"]; !ok {
+				t.Error("Raw is missing client_id")
+			}
+		})
+	}
+
+	// Claims still round-trip through JSON
+	claims := &JWTClaims{}
+	if err := json.Unmarshal([]byte(`{"scope":["a","b"],"aud":"x","exp":1}`), claims); err != nil {
+		t.Fatal(err)
+	}
+	if !claims.HasScope("b") || !claims.Audience.Contains("x") {
+		t.Errorf("claims = %+v, want scope b and audience x", claims)
+	}
+}
@@ -0,0 +1,186 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/umakantv/go-utils/logger"
+	"go.uber.org/zap"
+)
+
+// defaultDrainTimeout bounds how long Shutdown waits for in-flight requests
+const defaultDrainTimeout = 30 * time.Second
+
+// Hook runs when the server starts or shuts down, e.g. to open or close a
+// database or cache
+type Hook func(ctx context.Context) error
+
+// SetDrainTimeout sets how long Shutdown waits for in-flight requests before
+// closing their connections (default 30s)
+func (s *Server) SetDrainTimeout(timeout time.Duration) {
+	s.drainTimeout = timeout
+}
+
+// SetShutdownDelay sets how long Shutdown waits after the server stops
+// reporting ready before it stops accepting connections, so load balancers
+// polling the readiness route can take the instance out of rotation first
+func (s *Server) SetShutdownDelay(delay time.Duration) {
+	s.shutdownDelay = delay
+}
+
+// OnStart registers a hook that runs before the server starts listening.
+// Hooks run in the order registered; an error aborts Start.
+func (s *Server) OnStart(hook Hook) {
+	s.onStart = append(s.onStart, hook)
+}
+
+// OnShutdown registers a hook that runs after in-flight requests are drained.
+// Hooks run in reverse order of registration, like deferred calls.
+func (s *Server) OnShutdown(hook Hook) {
+	s.onShutdown = append(s.onShutdown, hook)
+}
+
+// Ready reports whether the server is listening and not shutting down
+func (s *Server) Ready() bool {
+	return atomic.LoadInt32(&s.ready) == 1
+}
+
+// ReadinessHandler answers 200 while the server is ready and 503 once it
+// starts shutting down; register it on a route with AuthType "none"
+func (s *Server) ReadinessHandler() Handler {
+	return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if !s.Ready() {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "shutting down"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+	})
+}
+
+// Start runs the OnStart hooks and serves requests until ctx is done, then
+// shuts down gracefully. It returns once shutdown completes, whether it was
+// triggered by ctx or by a call to Shutdown.
+//
+// If an OnStart hook fails, Start returns its error without running any
+// OnShutdown hooks. Once every OnStart hook has run, a failure to listen or
+// serve runs the OnShutdown hooks before Start returns the error.
+func (s *Server) Start(ctx context.Context) error {
+	for _, hook := range s.onStart {
+		if err := hook(ctx); err != nil {
+			return err
+		}
+	}
+
+	listener, err := net.Listen("tcp", ":"+s.port)
+	if err != nil {
+		return s.abort(err)
+	}
+
+	atomic.StoreInt32(&s.ready, 1)
+
+	logger.Info("Starting server", zap.String("port", s.port))
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.httpServer.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return s.abort(err)
+		}
+		// Shutdown was called directly; wait for it to finish
+		<-s.done
+		return s.shutdownErr
+	case <-ctx.Done():
+		return s.Shutdown(context.Background())
+	}
+}
+
+// Shutdown stops reporting ready, waits for the shutdown delay, stops
+// accepting connections and waits up to the drain timeout for in-flight
+// requests, then runs the OnShutdown hooks. Connections still open after the
+// drain timeout or when ctx is done are closed. Later calls return the result
+// of the first.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shutdownOnce.Do(func() {
+		s.shutdownErr = s.shutdown(ctx)
+		close(s.done)
+	})
+	return s.shutdownErr
+}
+
+// abort runs the OnShutdown hooks when Start fails after its OnStart hooks,
+// so resources they opened are released, and returns err. Later calls to
+// Shutdown return the hooks' result without running them again.
+func (s *Server) abort(err error) error {
+	atomic.StoreInt32(&s.ready, 0)
+	logger.Error("Server failed to start", zap.String("port", s.port), zap.Error(err))
+
+	s.shutdownOnce.Do(func() {
+		s.shutdownErr = s.runShutdownHooks(context.Background())
+		close(s.done)
+	})
+	return err
+}
+
+// shutdown drains the server and runs the OnShutdown hooks
+func (s *Server) shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&s.ready, 0)
+	logger.Info("Shutting down server")
+
+	if s.shutdownDelay > 0 {
+		select {
+		case <-time.After(s.shutdownDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	timeout := s.drainTimeout
+	if timeout <= 0 {
+		timeout = defaultDrainTimeout
+	}
+	drainCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var firstErr error
+	if err := s.httpServer.Shutdown(drainCtx); err != nil {
+		// Requests did not finish in time; drop their connections
+		s.httpServer.Close()
+		firstErr = err
+	}
+
+	if err := s.runShutdownHooks(ctx); firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// runShutdownHooks runs the OnShutdown hooks in reverse order, logging every
+// failure and returning the first
+func (s *Server) runShutdownHooks(ctx context.Context) error {
+	var firstErr error
+	for i := len(s.onShutdown) - 1; i >= 0; i-- {
+		if err := s.onShutdown[i](ctx); err != nil {
+			logger.Error("Shutdown hook failed", zap.Error(err))
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// SignalContext returns a context that is canceled on SIGINT or SIGTERM, for
+// passing to Start. Call stop to release the signal handler.
+func SignalContext(parent context.Context) (ctx context.Context, stop context.CancelFunc) {
+	return signal.NotifyContext(parent, os.Interrupt, syscall.SIGTERM)
+}
@@ -0,0 +1,185 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// freePort returns a port that was free a moment ago
+func freePort(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+}
+
+// events records lifecycle steps in the order they happen
+type events struct {
+	mutex sync.Mutex
+	list  []string
+}
+
+func (e *events) add(event string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.list = append(e.list, event)
+}
+
+func (e *events) get() []string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return append([]string(nil), e.list...)
+}
+
+// hook returns a lifecycle hook that records name
+func (e *events) hook(name string) Hook {
+	return func(ctx context.Context) error {
+		e.add(name)
+		return nil
+	}
+}
+
+// getStatus requests a path on the server, returning 0 if it cannot connect
+func getStatus(client *http.Client, port, path string) int {
+	resp, err := client.Get("http://127.0.0.1:" + port + path)
+	if err != nil {
+		return 0
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	port := freePort(t)
+	s := New(port, nil)
+	s.SetShutdownDelay(200 * time.Millisecond)
+
+	var log events
+	s.OnStart(log.hook("start"))
+	s.OnShutdown(log.hook("close database"))
+	s.OnShutdown(log.hook("close cache"))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s.Register(Route{Name: "Ready", Method: http.MethodGet, Path: "/ready", AuthType: AuthNone}, s.ReadinessHandler())
+	s.Register(Route{Name: "Slow", Method: http.MethodGet, Path: "/slow", AuthType: AuthNone},
+		HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			log.add("request done")
+			w.Write([]byte("done"))
+		}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	result := make(chan error, 1)
+	go func() { result <- s.Start(ctx) }()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	deadline := time.Now().Add(5 * time.Second)
+	for getStatus(client, port, "/ready") != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("server never became ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	slow := make(chan int, 1)
+	go func() { slow <- getStatus(client, port, "/slow") }()
+	<-started
+
+	cancel()
+
+	// During the shutdown delay the server still answers, but not ready
+	deadline = time.Now().Add(time.Second)
+	for s.Ready() {
+		if time.Now().After(deadline) {
+			t.Fatal("server still ready after shutdown began")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if status := getStatus(client, port, "/ready"); status != http.StatusServiceUnavailable {
+		t.Errorf("readiness during shutdown = %d, want 503", status)
+	}
+
+	close(release)
+	if status := <-slow; status != http.StatusOK {
+		t.Errorf("in-flight request status = %d, want 200", status)
+	}
+	if err := <-result; err != nil {
+		t.Fatalf("Start returned %v", err)
+	}
+
+	want := []string{"start", "request done", "close cache", "close database"}
+	if got := log.get(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("lifecycle = %v, want %v", got, want)
+	}
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Errorf("second Shutdown = %v, want the first result", err)
+	}
+	if got := log.get(); len(got) != len(want) {
+		t.Errorf("second Shutdown ran hooks again: %v", got)
+	}
+}
+
+func TestStartListenFailure(t *testing.T) {
+	taken, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+	port := strconv.Itoa(taken.Addr().(*net.TCPAddr).Port)
+
+	s := New(port, nil)
+	var log events
+	s.OnStart(log.hook("start"))
+	s.OnShutdown(log.hook("close database"))
+	hookErr := errors.New("cache already closed")
+	s.OnShutdown(func(ctx context.Context) error {
+		log.add("close cache")
+		return hookErr
+	})
+
+	if err := s.Start(context.Background()); err == nil {
+		t.Fatal("Start succeeded on a taken port")
+	}
+	want := []string{"start", "close cache", "close database"}
+	if got := log.get(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("lifecycle = %v, want %v", got, want)
+	}
+	if s.Ready() {
+		t.Error("server reports ready after failing to listen")
+	}
+
+	if err := s.Shutdown(context.Background()); err != hookErr {
+		t.Errorf("Shutdown = %v, want the hook error %v", err, hookErr)
+	}
+	if got := log.get(); len(got) != len(want) {
+		t.Errorf("Shutdown ran hooks again: %v", got)
+	}
+}
+
+func TestStartHookFailure(t *testing.T) {
+	s := New(freePort(t), nil)
+	var log events
+	startErr := errors.New("database unreachable")
+	s.OnStart(func(ctx context.Context) error { return startErr })
+	s.OnShutdown(log.hook("close database"))
+
+	if err := s.Start(context.Background()); err != startErr {
+		t.Fatalf("Start = %v, want %v", err, startErr)
+	}
+	if got := log.get(); len(got) != 0 {
+		t.Errorf("OnShutdown hooks ran after a failed OnStart: %v", got)
+	}
+}
@@ -0,0 +1,33 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+)
+
+// Middleware wraps a Handler to run code before and after it, e.g. for CORS,
+// compression or tracing. Call next.Handle to continue the chain, or write a
+// response and return to stop it.
+type Middleware func(next Handler) Handler
+
+// HTTPMiddleware adapts standard net/http middleware, such as third-party
+// CORS or compression handlers, to a Middleware. The context travels on the
+// request, so values the middleware adds are visible to the handlers after it.
+func HTTPMiddleware(mw func(http.Handler) http.Handler) Middleware {
+	return func(next Handler) Handler {
+		handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.Handle(r.Context(), w, r)
+		}))
+		return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			handler.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// chain wraps handler in middleware so that the first middleware runs first
+func chain(handler Handler, middleware []Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
@@ -0,0 +1,20 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/umakantv/go-utils/errs"
+)
+
+// writeError writes an AppError as JSON with its status code
+func writeError(w http.ResponseWriter, err *errs.AppError) {
+	writeJSON(w, err.Code, err)
+}
+
+// writeJSON writes body as JSON with the given status code
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,302 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/umakantv/go-utils/cache"
+	"github.com/umakantv/go-utils/logger"
+)
+
+// defaultResponseTTL is used when neither the response nor the config sets a lifetime
+const defaultResponseTTL = time.Minute
+
+// defaultResponseKeyPrefix is used when ResponseCacheConfig.KeyPrefix is not set
+const defaultResponseKeyPrefix = "httpcache:"
+
+// ResponseCacheConfig holds response caching configuration
+type ResponseCacheConfig struct {
+	TTL         time.Duration // Lifetime of responses without a max-age (default 1m)
+	VaryHeaders []string      // Request headers that are part of the cache key (e.g. "Accept", "Authorization")
+	Tags        []string      // Tags attached to every stored response, for cache.InvalidateTag
+	KeyPrefix   string        // Prefix for cache keys (default "httpcache:")
+}
+
+// ResponseCache caches successful GET responses in a cache.Cache. Responses
+// are keyed by route name, path variables, query string and the configured
+// request headers, and served with an ETag so clients can revalidate.
+type ResponseCache struct {
+	cache  *cache.TypedCache[cachedResponse]
+	config ResponseCacheConfig
+}
+
+// cachedResponse is a stored response
+type cachedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// NewResponseCache creates a response cache backed by c
+func NewResponseCache(c cache.Cache, config ResponseCacheConfig) *ResponseCache {
+	if config.TTL <= 0 {
+		config.TTL = defaultResponseTTL
+	}
+	if config.KeyPrefix == "" {
+		config.KeyPrefix = defaultResponseKeyPrefix
+	}
+	return &ResponseCache{
+		cache:  cache.NewTyped[cachedResponse](c, cache.JSONCodec),
+		config: config,
+	}
+}
+
+// Wrap returns a handler that serves GET requests from the cache and stores
+// the responses of next. Other methods are passed straight to next.
+func (rc *ResponseCache) Wrap(next Handler) Handler {
+	return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next.Handle(ctx, w, r)
+			return
+		}
+
+		directives := parseCacheControl(r.Header.Get("Cache-Control"))
+		if _, noStore := directives["no-store"]; noStore {
+			next.Handle(ctx, w, r)
+			return
+		}
+
+		key := rc.key(ctx, r)
+
+		// no-cache and max-age=0 ask for a fresh response, which is then stored
+		_, noCache := directives["no-cache"]
+		if !noCache && directives["max-age"] != "0" {
+			if resp, err := rc.cache.GetCtx(ctx, key); err == nil {
+				rc.serve(w, r, resp, "HIT")
+				return
+			}
+		}
+
+		// Headers set before next runs, e.g. by outer middleware, belong to
+		// this request only and are not stored
+		before := w.Header().Clone()
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.Handle(ctx, recorder, r)
+
+		resp := cachedResponse{
+			Status: recorder.status,
+			Header: headerChanges(before, w.Header()),
+			Body:   recorder.body.Bytes(),
+		}
+		if resp.Status == http.StatusOK && resp.Header.Get("ETag") == "" {
+			resp.Header.Set("ETag", computeETag(resp.Body))
+			w.Header().Set("ETag", resp.Header.Get("ETag"))
+		}
+
+		if ttl, ok := rc.ttl(r, resp); ok {
+			if err := rc.cache.SetWithTags(ctx, key, resp, ttl, rc.config.Tags); err != nil {
+				logger.Error(fmt.Sprintf("Failed to cache response: %s - %v", key, err))
+			}
+		}
+
+		rc.serve(w, r, resp, "MISS")
+	})
+}
+
+// InvalidateRoute removes every cached response of the named route
+func (rc *ResponseCache) InvalidateRoute(ctx context.Context, routeName string) error {
+	return rc.cache.Cache().DeletePrefix(ctx, rc.config.KeyPrefix+routeName+":")
+}
+
+// key builds the cache key for a request. The route name stays readable so
+// InvalidateRoute can delete by prefix; the rest is hashed to bound its length.
+func (rc *ResponseCache) key(ctx context.Context, r *http.Request) string {
+	route := GetRouteName(ctx)
+	if route == "" {
+		route = r.URL.Path
+	}
+
+	vars := mux.Vars(r)
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hash := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(hash, "var:%s=%s\n", name, vars[name])
+	}
+	fmt.Fprintf(hash, "query:%s\n", r.URL.Query().Encode())
+	for _, name := range rc.config.VaryHeaders {
+		fmt.Fprintf(hash, "header:%s=%s\n", http.CanonicalHeaderKey(name), strings.Join(r.Header.Values(name), ","))
+	}
+
+	return rc.config.KeyPrefix + route + ":" + hex.EncodeToString(hash.Sum(nil)[:16])
+}
+
+// ttl reports how long a response may be stored, following its
+// Cache-Control header. Only complete 200 responses without cookies are
+// stored, and responses to authorized requests only when they are marked
+// public or the Authorization header is part of the key. Responses that
+// Vary on a request header outside VaryHeaders are not stored, since the
+// key could not tell their variants apart.
+func (rc *ResponseCache) ttl(r *http.Request, resp cachedResponse) (time.Duration, bool) {
+	if resp.Status != http.StatusOK || resp.Header.Get("Set-Cookie") != "" {
+		return 0, false
+	}
+
+	for _, value := range resp.Header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" || name != "" && !rc.varies(name) {
+				return 0, false
+			}
+		}
+	}
+
+	directives := parseCacheControl(resp.Header.Get("Cache-Control"))
+	for _, directive := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := directives[directive]; ok {
+			return 0, false
+		}
+	}
+
+	_, public := directives["public"]
+	_, shared := directives["s-maxage"]
+	if r.Header.Get("Authorization") != "" && !public && !shared && !rc.varies("Authorization") {
+		return 0, false
+	}
+
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		if value, ok := directives[directive]; ok {
+			seconds, err := strconv.Atoi(value)
+			if err != nil || seconds <= 0 {
+				return 0, false
+			}
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	return rc.config.TTL, true
+}
+
+// varies reports whether a request header is part of the cache key
+func (rc *ResponseCache) varies(name string) bool {
+	for _, header := range rc.config.VaryHeaders {
+		if strings.EqualFold(header, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// serve writes a response, answering with 304 Not Modified when the client
+// already has it
+func (rc *ResponseCache) serve(w http.ResponseWriter, r *http.Request, resp cachedResponse, status string) {
+	header := w.Header()
+	for name, values := range resp.Header {
+		header[name] = values
+	}
+	header.Set("X-Cache", status)
+
+	if etag := resp.Header.Get("ETag"); etag != "" && etagMatches(r.Header.Get("If-None-Match"), etag) {
+		header.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
+
+// headerChanges returns the headers in after that were added or changed
+// since before
+func headerChanges(before, after http.Header) http.Header {
+	changes := make(http.Header)
+	for name, values := range after {
+		if !equalValues(before[name], values) {
+			changes[name] = append([]string(nil), values...)
+		}
+	}
+	return changes
+}
+
+// equalValues reports whether two header value lists are identical
+func equalValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// responseRecorder buffers the status and body written by a handler
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+// WriteHeader records the status code
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+}
+
+// Write buffers the body
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.wroteHeader = true
+	return r.body.Write(data)
+}
+
+// parseCacheControl splits a Cache-Control header into lower-cased directives
+func parseCacheControl(header string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(part, "=")
+		directives[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return directives
+}
+
+// computeETag derives a strong ETag from a response body
+func computeETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header matches etag, using
+// the weak comparison RFC 7232 prescribes for If-None-Match
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,267 @@
+package httpserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/umakantv/go-utils/cache"
+)
+
+// responseCacheServer registers handler behind a response cache on a new
+// server and returns both with a counter of handler calls
+func responseCacheServer(t *testing.T, config ResponseCacheConfig, handler HandlerFunc) (*Server, *ResponseCache, cache.Cache, *int32) {
+	t.Helper()
+	c, err := cache.New(cache.Config{Type: "memory"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	calls := new(int32)
+	responses := NewResponseCache(c, config)
+	s := New("0", nil)
+	s.Register(Route{Name: "Items", Method: http.MethodGet, Path: "/items/{id}", AuthType: AuthNone, Middleware: []Middleware{responses.Wrap}},
+		HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(calls, 1)
+			handler(ctx, w, r)
+		}))
+	return s, responses, c, calls
+}
+
+// get sends a GET request with the given headers
+func get(s *Server, path string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	return serve(s, req)
+}
+
+func TestResponseCacheHitAndMiss(t *testing.T) {
+	s, _, _, calls := responseCacheServer(t, ResponseCacheConfig{}, func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "item %s", r.URL.Path)
+	})
+
+	first := get(s, "/items/1")
+	if first.Code != http.StatusOK || first.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("first: status %d, X-Cache %q, want 200 MISS", first.Code, first.Header().Get("X-Cache"))
+	}
+	second := get(s, "/items/1")
+	if second.Header().Get("X-Cache") != "HIT" || second.Body.String() != first.Body.String() {
+		t.Fatalf("second: X-Cache %q body %q, want HIT %q", second.Header().Get("X-Cache"), second.Body.String(), first.Body.String())
+	}
+	if second.Header().Get("Content-Type") != "text/plain" || second.Header().Get("ETag") == "" {
+		t.Errorf("HIT headers = %v, want Content-Type and ETag", second.Header())
+	}
+	if get(s, "/items/2").Header().Get("X-Cache") != "MISS" {
+		t.Error("another path variable was served from the cache")
+	}
+	if get(s, "/items/1?page=2").Header().Get("X-Cache") != "MISS" {
+		t.Error("another query string was served from the cache")
+	}
+	if get(s, "/items/1", "Cache-Control", "no-cache").Header().Get("X-Cache") != "MISS" {
+		t.Error("request no-cache was served from the cache")
+	}
+	if n := atomic.LoadInt32(calls); n != 4 {
+		t.Errorf("handler calls = %d, want 4", n)
+	}
+}
+
+func TestResponseCacheStoresOnlyHandlerHeaders(t *testing.T) {
+	s, _, _, _ := responseCacheServer(t, ResponseCacheConfig{}, func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Item-Version", "3")
+		w.Write([]byte("item"))
+	})
+	requests := 0
+	s.Use(func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Header().Set("X-Request-ID", fmt.Sprintf("req-%d", requests))
+			w.Header().Set("Access-Control-Allow-Origin", r.Header.Get("Origin"))
+			next.Handle(ctx, w, r)
+		})
+	})
+
+	get(s, "/items/1", "Origin", "https://a.example")
+	rec := get(s, "/items/1", "Origin", "https://b.example")
+	if rec.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("X-Cache = %q, want HIT", rec.Header().Get("X-Cache"))
+	}
+	if got := rec.Header().Get("X-Request-ID"); got != "req-2" {
+		t.Errorf("X-Request-ID = %q, want req-2", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://b.example" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want https://b.example", got)
+	}
+	if got := rec.Header().Get("X-Item-Version"); got != "3" {
+		t.Errorf("X-Item-Version = %q, want 3", got)
+	}
+}
+
+func TestResponseCacheControl(t *testing.T) {
+	tests := []struct {
+		name         string
+		cacheControl string
+		vary         string
+		stored       bool
+		ttl          time.Duration
+	}{
+		{"default", "", "", true, time.Minute},
+		{"max-age", "max-age=120", "", true, 2 * time.Minute},
+		{"s-maxage wins", "max-age=120, s-maxage=30", "", true, 30 * time.Second},
+		{"no-store", "no-store", "", false, 0},
+		{"no-cache", "no-cache", "", false, 0},
+		{"private", "private, max-age=60", "", false, 0},
+		{"max-age=0", "max-age=0", "", false, 0},
+		{"vary on key header", "", "Accept-Language", true, time.Minute},
+		{"vary on other header", "", "Accept-Encoding", false, 0},
+		{"vary star", "", "*", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _, c, calls := responseCacheServer(t, ResponseCacheConfig{VaryHeaders: []string{"Accept-Language"}}, func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+				if tt.cacheControl != "" {
+					w.Header().Set("Cache-Control", tt.cacheControl)
+				}
+				if tt.vary != "" {
+					w.Header().Set("Vary", tt.vary)
+				}
+				w.Write([]byte("item"))
+			})
+
+			get(s, "/items/1")
+			get(s, "/items/1")
+			wantCalls := int32(2)
+			if tt.stored {
+				wantCalls = 1
+			}
+			if n := atomic.LoadInt32(calls); n != wantCalls {
+				t.Fatalf("handler calls = %d, want %d", n, wantCalls)
+			}
+
+			keys, err := c.Keys(context.Background(), "*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.stored {
+				if len(keys) != 0 {
+					t.Errorf("stored keys %v, want none", keys)
+				}
+				return
+			}
+			if len(keys) != 1 {
+				t.Fatalf("stored keys %v, want one", keys)
+			}
+			ttl, err := c.TTL(context.Background(), keys[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ttl <= tt.ttl-time.Second || ttl > tt.ttl {
+				t.Errorf("TTL = %v, want about %v", ttl, tt.ttl)
+			}
+		})
+	}
+}
+
+func TestResponseCacheRequestNoStore(t *testing.T) {
+	s, _, c, _ := responseCacheServer(t, ResponseCacheConfig{}, func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("item"))
+	})
+
+	rec := get(s, "/items/1", "Cache-Control", "no-store")
+	if rec.Header().Get("X-Cache") != "" {
+		t.Errorf("X-Cache = %q, want the cache bypassed", rec.Header().Get("X-Cache"))
+	}
+	if keys, _ := c.Keys(context.Background(), "*"); len(keys) != 0 {
+		t.Errorf("stored keys %v, want none", keys)
+	}
+}
+
+func TestResponseCacheNotModified(t *testing.T) {
+	s, _, _, _ := responseCacheServer(t, ResponseCacheConfig{}, func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("item"))
+	})
+
+	etag := get(s, "/items/1").Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("response has no ETag")
+	}
+
+	rec := get(s, "/items/1", "If-None-Match", etag)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("status %d body %q, want 304 with no body", rec.Code, rec.Body.String())
+	}
+	if rec := get(s, "/items/1", "If-None-Match", `"other", W/`+etag); rec.Code != http.StatusNotModified {
+		t.Errorf("weak match status = %d, want 304", rec.Code)
+	}
+	if rec := get(s, "/items/1", "If-None-Match", `"other"`); rec.Code != http.StatusOK {
+		t.Errorf("mismatch status = %d, want 200", rec.Code)
+	}
+}
+
+func TestResponseCacheVaryHeaders(t *testing.T) {
+	s, _, _, calls := responseCacheServer(t, ResponseCacheConfig{VaryHeaders: []string{"Accept-Language"}}, func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello in " + r.Header.Get("Accept-Language")))
+	})
+
+	get(s, "/items/1", "Accept-Language", "en")
+	rec := get(s, "/items/1", "Accept-Language", "fr")
+	if rec.Header().Get("X-Cache") != "MISS" || rec.Body.String() != "hello in fr" {
+		t.Fatalf("fr: X-Cache %q body %q, want MISS in fr", rec.Header().Get("X-Cache"), rec.Body.String())
+	}
+	rec = get(s, "/items/1", "Accept-Language", "en")
+	if rec.Header().Get("X-Cache") != "HIT" || rec.Body.String() != "hello in en" {
+		t.Fatalf("en: X-Cache %q body %q, want HIT in en", rec.Header().Get("X-Cache"), rec.Body.String())
+	}
+	if n := atomic.LoadInt32(calls); n != 2 {
+		t.Errorf("handler calls = %d, want 2", n)
+	}
+}
+
+func TestResponseCacheAuthorization(t *testing.T) {
+	public := false
+	s, _, _, calls := responseCacheServer(t, ResponseCacheConfig{}, func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if public {
+			w.Header().Set("Cache-Control", "public")
+		}
+		w.Write([]byte("item"))
+	})
+
+	get(s, "/items/1", "Authorization", "Bearer a")
+	get(s, "/items/1", "Authorization", "Bearer a")
+	if n := atomic.LoadInt32(calls); n != 2 {
+		t.Fatalf("handler calls = %d, want 2 for an authorized response", n)
+	}
+
+	public = true
+	get(s, "/items/1", "Authorization", "Bearer a")
+	if rec := get(s, "/items/1", "Authorization", "Bearer b"); rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("X-Cache = %q, want a public response shared", rec.Header().Get("X-Cache"))
+	}
+}
+
+func TestResponseCacheInvalidateRoute(t *testing.T) {
+	s, responses, _, calls := responseCacheServer(t, ResponseCacheConfig{}, func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("item"))
+	})
+
+	get(s, "/items/1")
+	get(s, "/items/2")
+	if err := responses.InvalidateRoute(context.Background(), "Items"); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/items/1", "/items/2"} {
+		if rec := get(s, path); rec.Header().Get("X-Cache") != "MISS" {
+			t.Errorf("%s: X-Cache = %q after InvalidateRoute, want MISS", path, rec.Header().Get("X-Cache"))
+		}
+	}
+	if n := atomic.LoadInt32(calls); n != 4 {
+		t.Errorf("handler calls = %d, want 4", n)
+	}
+}
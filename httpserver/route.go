@@ -5,5 +5,30 @@ type Route struct {
 	Name     string
 	Method   string
 	Path     string
-	AuthType string // "none", "basic", "bearer"
-}
\ No newline at end of file
+	AuthType string // "none", "basic", "bearer", "api-key" or a custom type
+
+	// AuthTypes lists alternative auth types, any of which authenticates the
+	// request (e.g. bearer or api-key); it takes precedence over AuthType.
+	// Including "none" makes authentication optional.
+	AuthTypes []string
+
+	// Scopes must all be granted and at least one of Roles held by the
+	// authenticated client, checked against RequestAuth.Claims; requests
+	// failing either get a 403
+	Scopes []string
+	Roles  []string
+
+	// Policy runs after the scope and role checks for further authorization
+	Policy Policy
+
+	// Middleware runs after authentication, in order, just before the handler
+	Middleware []Middleware
+}
+
+// authTypes returns the auth types the route accepts
+func (r Route) authTypes() []string {
+	if len(r.AuthTypes) > 0 {
+		return r.AuthTypes
+	}
+	return []string{r.AuthType}
+}
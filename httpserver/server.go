@@ -4,75 +4,150 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/umakantv/go-utils/errs"
 	"github.com/umakantv/go-utils/logger"
 )
 
 // Server represents the HTTP server
 type Server struct {
-	router       *mux.Router
-	port         string
-	authCallback AuthCallback
+	router         *mux.Router
+	port           string
+	authCallback   AuthCallback
+	authenticators map[string]Authenticator
+	middleware     []Middleware
+
+	// Authorization
+	policy      Policy
+	policyMutex sync.RWMutex
+
+	// Lifecycle
+	httpServer    *http.Server
+	drainTimeout  time.Duration
+	shutdownDelay time.Duration
+	onStart       []Hook
+	onShutdown    []Hook
+	ready         int32 // 1 while serving and not shutting down
+	done          chan struct{}
+	shutdownOnce  sync.Once
+	shutdownErr   error
 }
 
-// New creates a new HTTP server with authentication callback
+// New creates a new HTTP server. authCallback authenticates routes whose auth
+// type has no registered Authenticator; it may be nil.
 func New(port string, authCallback AuthCallback) *Server {
+	router := mux.NewRouter()
 	return &Server{
-		router:       mux.NewRouter(),
-		port:         port,
-		authCallback: authCallback,
+		router:         router,
+		port:           port,
+		authCallback:   authCallback,
+		authenticators: make(map[string]Authenticator),
+		httpServer:     &http.Server{Handler: router},
+		done:           make(chan struct{}),
 	}
 }
 
+// RegisterAuthenticator sets the Authenticator for routes with the given auth type
+func (s *Server) RegisterAuthenticator(authType string, authenticator Authenticator) {
+	s.authenticators[authType] = authenticator
+}
+
+// Use adds middleware that runs for every route, in the order added, before
+// authentication. Call it before the server starts handling requests.
+func (s *Server) Use(middleware ...Middleware) {
+	s.middleware = append(s.middleware, middleware...)
+}
+
 // Register registers a route with its handler
 func (s *Server) Register(route Route, handler Handler) {
 	s.router.HandleFunc(route.Path, s.wrapHandler(route, handler)).Methods(route.Method).Name(route.Name)
 }
 
-// wrapHandler wraps the handler with authentication, logging, and context injection
+// wrapHandler wraps the handler with context injection, logging, server
+// middleware, authentication and route middleware, in that order. The chain
+// is built on the first request, so middleware added with Use after Register
+// still applies.
 func (s *Server) wrapHandler(route Route, handler Handler) http.HandlerFunc {
+	var once sync.Once
+	var chained Handler
+
 	return func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() {
+			authorized := s.authorize(route, chain(handler, route.Middleware))
+			authenticated := s.authenticate(route, authorized)
+			chained = chain(authenticated, s.middleware)
+		})
+
+		// Inject request details into context
 		ctx := r.Context()
+		ctx = context.WithValue(ctx, RouteNameKey, route.Name)
+		ctx = context.WithValue(ctx, RouteMethodKey, route.Method)
+		ctx = context.WithValue(ctx, RoutePathKey, route.Path)
+		ctx = context.WithValue(ctx, AuthTypeKey, route.AuthType)
+
+		// Log the request
+		logger.Info(fmt.Sprintf("Received request: %s - %s - %s", route.Name, route.Method, r.URL.Path))
+
+		chained.Handle(ctx, w, r.WithContext(ctx))
+	}
+}
 
-		var requestAuth *RequestAuth
+// authenticate returns a handler that tries the route's auth types in order
+// and passes the first successful RequestAuth to next in the context. Auth
+// types without a registered Authenticator fall back to the auth callback.
+// Routes allowing "none" only pass requests on anonymously if they carry no
+// credentials; invalid credentials get a 401 as on any other route.
+func (s *Server) authenticate(route Route, next Handler) Handler {
+	authTypes := route.authTypes()
+	optional := false
+	for _, authType := range authTypes {
+		if authType == AuthNone {
+			optional = true
+		}
+	}
+
+	return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		presented := false
+		for _, authType := range authTypes {
+			if authType == AuthNone {
+				continue
+			}
 
-		// Handle authentication
-		if route.AuthType != "none" {
-			if s.authCallback == nil {
-				http.Error(w, "Authentication callback not configured", http.StatusInternalServerError)
+			authenticator := s.authenticator(authType)
+			if authenticator == nil {
+				http.Error(w, "Authentication not configured for auth type: "+authType, http.StatusInternalServerError)
 				return
 			}
 
-			authenticated, auth := s.authCallback(r)
-			if !authenticated {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			if authenticated, auth := authenticator.Authenticate(r); authenticated {
+				if auth.Type == "" {
+					auth.Type = authType
+				}
+				ctx = context.WithValue(ctx, RequestAuthKey, auth)
+				next.Handle(ctx, w, r.WithContext(ctx))
 				return
 			}
-			requestAuth = &auth
+			presented = presented || hasCredentials(authenticator, r)
 		}
 
-		// Log the request
-		logger.Info(fmt.Sprintf("Received request: %s - %s - %s", route.Name, route.Method, r.URL.Path))
-
-		// Inject request details into context
-		ctx = context.WithValue(ctx, RouteNameKey, route.Name)
-		ctx = context.WithValue(ctx, RouteMethodKey, route.Method)
-		ctx = context.WithValue(ctx, RoutePathKey, route.Path)
-		ctx = context.WithValue(ctx, AuthTypeKey, route.AuthType)
-		if requestAuth != nil {
-			ctx = context.WithValue(ctx, RequestAuthKey, *requestAuth)
+		if !optional || presented {
+			writeError(w, errs.NewAuthenticationError("Unauthorized"))
+			return
 		}
+		next.Handle(ctx, w, r)
+	})
+}
 
-		// Call the handler
-		handler.Handle(ctx, w, r)
+// authenticator returns the Authenticator for an auth type, or nil if there is none
+func (s *Server) authenticator(authType string) Authenticator {
+	if authenticator, ok := s.authenticators[authType]; ok {
+		return authenticator
 	}
+	if s.authCallback != nil {
+		return s.authCallback
+	}
+	return nil
 }
-
-
-
-// Start starts the HTTP server
-func (s *Server) Start() error {
-	fmt.Printf("Starting server on port %s\n", s.port)
-	return http.ListenAndServe(":"+s.port, s.router)
-}
\ No newline at end of file